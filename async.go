@@ -0,0 +1,131 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"sync/atomic"
+)
+
+// overflow policies of an AsyncHandler
+const (
+	OverflowBlock   = "block"
+	OverflowDropNew = "drop_new"
+	OverflowDropOld = "drop_old"
+)
+
+// AsyncHandler hands records to a goroutine that forwards them to the
+// wrapped handler, through a buffer. What happens when the buffer is full
+// is up to the Overflow policy: OverflowBlock waits for room like log15's
+// BufferedHandler, OverflowDropNew drops the incoming record and
+// OverflowDropOld drops the oldest buffered one to make room. The drop
+// policies never block the caller; the dropped records are counted (see
+// Dropped).
+type AsyncHandler struct {
+	Overflow string
+
+	h       Handler
+	recs    chan *log15.Record
+	mu      sync.RWMutex
+	closed  bool
+	dropped uint64
+	wg      sync.WaitGroup
+}
+
+// MakeAsyncHandler prepares a handler buffering up to @bufSize records
+// for @h with the @overflow policy and starts forwarding them
+func MakeAsyncHandler(bufSize int, overflow string, h Handler) (*AsyncHandler, error) {
+	switch overflow {
+	case OverflowBlock, OverflowDropNew, OverflowDropOld:
+	default:
+		return nil, fmt.Errorf("%w: unknown overflow policy %q", BadConf, overflow)
+	}
+
+	if bufSize < 1 {
+		return nil, fmt.Errorf("%w: expected a buffer size of at least 1, got %d", BadConf, bufSize)
+	}
+
+	p := &AsyncHandler{
+		Overflow: overflow,
+		h:        h,
+		recs:     make(chan *log15.Record, bufSize),
+	}
+
+	p.wg.Add(1)
+	go p.forward()
+
+	return p, nil
+}
+
+func (p *AsyncHandler) Log(r *log15.Record) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		atomic.AddUint64(&p.dropped, 1)
+		return nil
+	}
+
+	switch p.Overflow {
+	case OverflowDropNew:
+		select {
+		case p.recs <- r:
+		default:
+			atomic.AddUint64(&p.dropped, 1)
+		}
+
+	case OverflowDropOld:
+		for {
+			select {
+			case p.recs <- r:
+				return nil
+			default:
+			}
+
+			// full; drop the oldest record to make room
+			select {
+			case <-p.recs:
+				atomic.AddUint64(&p.dropped, 1)
+			default:
+			}
+		}
+
+	default:
+		p.recs <- r
+	}
+
+	return nil
+}
+
+// forward passes buffered records on until
+// the handler is closed and the buffer drained
+func (p *AsyncHandler) forward() {
+	defer p.wg.Done()
+
+	for r := range p.recs {
+		p.h.Log(r)
+	}
+}
+
+// Dropped returns the number of records that were discarded because
+// the buffer was full or the handler was closed
+func (p *AsyncHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close stops accepting records, waits for the buffered ones to be
+// forwarded and then flushes and closes the wrapped handler if it needs
+// it. It is safe to call Close more than once.
+func (p *AsyncHandler) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.recs)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return closeTree(p.h)
+}
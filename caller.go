@@ -0,0 +1,99 @@
+package log
+
+import (
+	"github.com/go-stack/stack"
+	"gopkg.in/inconshreveable/log15.v2"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// pkgPath is the import path of this package, used to skip over
+// our own wrapper frames (eg: Printf) when looking for the caller
+var pkgPath = funcPkg(runtime.FuncForPC(reflect.ValueOf(Printf).Pointer()).Name())
+
+// funcPkg extracts the package path out of a fully qualified
+// function name such as "github.com/a/b.(*T).Method"
+func funcPkg(fn string) string {
+	slash := strings.LastIndex(fn, "/")
+	if dot := strings.Index(fn[slash+1:], "."); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
+
+// userCall returns the call site of @r. If the record was logged via
+// one of this package's wrappers the wrapper frames are skipped so
+// that the call points at user code. Skipping is only possible while
+// still on the logging goroutine; otherwise the recorded call is used.
+func userCall(r *log15.Record) stack.Call {
+	if funcPkg(r.Call.Frame().Function) != pkgPath {
+		return r.Call
+	}
+
+	for _, c := range stack.Trace().TrimBelow(r.Call) {
+		if funcPkg(c.Frame().Function) != pkgPath {
+			return c
+		}
+	}
+
+	return r.Call
+}
+
+// CallerPkgHandler returns a handler that adds the package path
+// of the calling function to the context with key "pkg".
+func CallerPkgHandler(h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		fn := userCall(r).Frame().Function
+		r.Ctx = append(r.Ctx, "pkg", funcPkg(fn))
+		return h.Log(r)
+	})
+}
+
+// ErrorCallerHandler returns a handler that adds the "file" (base name)
+// and "line" of the calling code to records at error level and above.
+// Records below error are passed on to @h without looking up the caller.
+func ErrorCallerHandler(h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		if r.Lvl > log15.LvlError {
+			return h.Log(r)
+		}
+
+		f := userCall(r).Frame()
+		r.Ctx = append(r.Ctx, "file", path.Base(f.File), "line", f.Line)
+		return h.Log(r)
+	})
+}
+
+// StackFrame is one call site in the structured stack attached
+// by the "caller_stack_structured" handler
+type StackFrame struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Func string `json:"func"`
+}
+
+// CallerStackStructuredHandler returns a handler that adds the stack
+// trace to the context with key "stack" as a slice of StackFrame, most
+// recent call first, so that JSON formats emit it as an array of
+// {file, line, func} objects. At most @depth frames are included.
+func CallerStackStructuredHandler(depth int, h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		s := stack.Trace().TrimBelow(userCall(r)).TrimRuntime()
+		if len(s) > depth {
+			s = s[:depth]
+		}
+
+		if len(s) > 0 {
+			frames := make([]StackFrame, len(s))
+			for i, c := range s {
+				f := c.Frame()
+				frames[i] = StackFrame{File: f.File, Line: f.Line, Func: f.Function}
+			}
+			r.Ctx = append(r.Ctx, "stack", frames)
+		}
+
+		return h.Log(r)
+	})
+}
@@ -0,0 +1,73 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+)
+
+// a capture collects the records logged during one CaptureLogs call
+type capture struct {
+	records []*Record
+}
+
+// state of the capturing tee installed around the root handler
+var captures struct {
+	sync.Mutex
+	active map[*capture]struct{}
+	orig   log15.Handler // root handler before the tee was installed
+}
+
+// captureTee copies each record to all active captures and passes
+// it on to the root handler that was in place before the tee
+var captureTee = log15.FuncHandler(func(r *log15.Record) error {
+	captures.Lock()
+	for c := range captures.active {
+		rc := *r
+		rc.Ctx = append([]interface{}(nil), r.Ctx...)
+		c.records = append(c.records, (*Record)(&rc))
+	}
+	h := captures.orig
+	captures.Unlock()
+
+	return h.Log(r)
+})
+
+// CaptureLogs runs @fn with a capturing tee around the root handler and
+// returns the records logged during the call. Records still reach the
+// real handler. The root handler is restored once @fn returns, even if
+// it panics, eg:
+//	recs := log.CaptureLogs(func() { fetch("bad url") })
+//	// assert on recs[0].Msg, recs[0].Ctx ...
+//
+// NOTE: the root handler is global state. Concurrent CaptureLogs calls
+// (eg: from parallel tests) share a single tee, so each call sees every
+// record logged while it is active, including those logged by other
+// tests. SetHandler may be called while a capture is active; the
+// handler it sets stays in place when the capture ends.
+func CaptureLogs(fn func()) []*Record {
+	c := &capture{}
+
+	captures.Lock()
+	if len(captures.active) == 0 {
+		captures.active = make(map[*capture]struct{})
+		captures.orig = Root().GetHandler()
+		Root().SetHandler(captureTee)
+	}
+	captures.active[c] = struct{}{}
+	captures.Unlock()
+
+	defer func() {
+		captures.Lock()
+		delete(captures.active, c)
+		if len(captures.active) == 0 {
+			Root().SetHandler(captures.orig)
+		}
+		captures.Unlock()
+	}()
+
+	fn()
+
+	captures.Lock()
+	defer captures.Unlock()
+	return c.records
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"regexp"
+	"strings"
+)
+
+// CEFSeverities maps log15 levels to CEF severities (0 to 10)
+var CEFSeverities = map[Lvl]int{
+	LvlCrit:  10,
+	LvlError: 7,
+	LvlWarn:  5,
+	LvlInfo:  3,
+	LvlDebug: 1,
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+	cefKeyRe         = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// CEFFormat renders each record as an ArcSight Common Event Format line:
+//	CEF:0|deepcompute|log|1.0|<event>|<msg>|<severity>|rt=<unix ms> k=v ...
+// <event> is the "event" ctx field when present and the message
+// otherwise. <severity> comes from CEFSeverities. The ctx fields follow as
+// extensions, their keys stripped of characters CEF doesn't allow.
+func CEFFormat() Format {
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		event := r.Msg
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if r.Ctx[i] == "event" {
+				event = fmt.Sprint(r.Ctx[i+1])
+				break
+			}
+		}
+
+		b := &bytes.Buffer{}
+		fmt.Fprintf(b, "CEF:0|deepcompute|log|1.0|%s|%s|%d|rt=%d",
+			cefHeaderEscaper.Replace(event),
+			cefHeaderEscaper.Replace(r.Msg),
+			CEFSeverities[Lvl(r.Lvl)],
+			r.Time.UnixNano()/1e6)
+
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			k := cefKeyRe.ReplaceAllString(fmt.Sprint(r.Ctx[i]), "")
+			if k == "" {
+				continue
+			}
+
+			v := r.Ctx[i+1]
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+
+			fmt.Fprintf(b, " %s=%s", k, cefValueEscaper.Replace(fmt.Sprintf("%+v", v)))
+		}
+
+		b.WriteByte('\n')
+		return b.Bytes()
+	})
+}
@@ -0,0 +1,71 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"sync/atomic"
+)
+
+// ChannelHandler delivers log records to a buffered go channel so that
+// in-process consumers (a live tail, a debug UI) can read them directly.
+//
+// The handler never blocks the logger. When the channel is full the record
+// is dropped and counted (see Dropped). Once Close is called, the channel
+// is closed and all further records are dropped.
+type ChannelHandler struct {
+	mu      sync.RWMutex
+	recs    chan *Record
+	closed  bool
+	dropped uint64
+}
+
+// MakeChannelHandler prepares a handler that writes records to a channel
+// buffered with @bufSize slots. The receive end of the channel is returned
+// along with the handler. Call Close on the handler to unregister the
+// consumer; this closes the channel.
+func MakeChannelHandler(bufSize int) (*ChannelHandler, <-chan *Record) {
+	if bufSize < 0 {
+		bufSize = 0
+	}
+
+	p := &ChannelHandler{recs: make(chan *Record, bufSize)}
+	return p, p.recs
+}
+
+func (p *ChannelHandler) Log(r *log15.Record) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		atomic.AddUint64(&p.dropped, 1)
+		return nil
+	}
+
+	select {
+	case p.recs <- (*Record)(r):
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+	}
+
+	return nil
+}
+
+// Dropped returns the number of records that were discarded because
+// the channel was full or already closed.
+func (p *ChannelHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close unregisters the consumer by closing the channel. It is safe
+// to call Close more than once.
+func (p *ChannelHandler) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.closed {
+		p.closed = true
+		close(p.recs)
+	}
+
+	return nil
+}
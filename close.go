@@ -0,0 +1,116 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"io"
+	"net"
+	"sync"
+)
+
+// Flushable is implemented by handlers that hold records back (eg: to
+// batch them) and can be asked to send them on right away
+type Flushable interface {
+	Flush() error
+}
+
+// Close flushes and closes the handler installed on the root logger (see
+// SetHandler), which in turn closes every handler it wraps, eg: a multi
+// closes its children in priority order. Handlers built by MakeHandler
+// that buffer records or hold a file or connection (eg: async, buffered,
+// file, net, kafka, redis) are io.Closers, as are the handlers wrapping
+// them; handlers built by registered factories take part when they
+// implement Flushable or io.Closer. Call it before exiting so that the
+// last records are not lost, ie: deferred in main
+//	defer log.Close()
+// or from a signal handler when exiting on a signal
+//	<-sigs
+//	log.Close()
+//	os.Exit(1)
+// Handlers that are not installed on the root logger, eg: those replaced
+// by SetHandlerAtomic or used by other loggers, are left to the caller to
+// close. All handlers in the tree are flushed and closed even if some
+// fail; the first error is returned.
+func Close() error {
+	return closeTree(Root().GetHandler())
+}
+
+// closeTree flushes @v if it is Flushable and closes it if it is an
+// io.Closer, returning the first error
+func closeTree(v interface{}) error {
+	var err error
+	if f, ok := v.(Flushable); ok {
+		err = f.Flush()
+	}
+	if c, ok := v.(io.Closer); ok {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ownerHandler is a handler wrapping others which need flushing or
+// closing, eg: caller_file over a file, which closes them when closed
+type ownerHandler struct {
+	Handler
+	children []interface{}
+}
+
+// withChildren returns @h, which forwards records to @children, made to
+// flush and close those that need it, in order, when it is closed. @h is
+// returned as is when none do, or when it closes them itself.
+func withChildren(h Handler, children ...interface{}) Handler {
+	if _, ok := h.(io.Closer); ok {
+		return h
+	}
+
+	var owned []interface{}
+	for _, c := range children {
+		_, flushable := c.(Flushable)
+		_, closer := c.(io.Closer)
+		if flushable || closer {
+			owned = append(owned, c)
+		}
+	}
+
+	if len(owned) == 0 {
+		return h
+	}
+	return &ownerHandler{Handler: h, children: owned}
+}
+
+// Close flushes and closes the children in order. All are closed even if
+// some fail; the first error is returned.
+func (p *ownerHandler) Close() error {
+	var err error
+	for _, c := range p.children {
+		if e := closeTree(c); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// closingHandler is a stream handler that can close its stream
+type closingHandler struct {
+	Handler
+	c    io.Closer
+	once sync.Once
+	err  error
+}
+
+// Close closes the stream. It is safe to call Close more than once.
+func (p *closingHandler) Close() error {
+	p.once.Do(func() { p.err = p.c.Close() })
+	return p.err
+}
+
+// netHandler is log15.NetHandler returning a handler that closes
+// the connection on Close
+func netHandler(network, addr string, fmtr Format) (*closingHandler, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &closingHandler{Handler: log15.StreamHandler(conn, fmtr), c: conn}, nil
+}
@@ -0,0 +1,152 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// closeLog records the names of the "test_closer" handlers as they are
+// flushed and closed
+var closeLog struct {
+	sync.Mutex
+	events []string
+}
+
+type testCloser struct {
+	name string
+}
+
+func (p *testCloser) Log(r *log15.Record) error {
+	return nil
+}
+
+func (p *testCloser) Flush() error {
+	closeLog.Lock()
+	defer closeLog.Unlock()
+
+	closeLog.events = append(closeLog.events, "flush "+p.name)
+	return nil
+}
+
+func (p *testCloser) Close() error {
+	closeLog.Lock()
+	defer closeLog.Unlock()
+
+	closeLog.events = append(closeLog.events, "close "+p.name)
+	return nil
+}
+
+var registerTestCloser sync.Once
+
+// closeEvents builds @conf, where HandlerConf{"test_closer", name} is a
+// handler recording when it is flushed and closed, installs it, calls
+// @f and returns what was flushed and closed meanwhile. The previous
+// root handler is put back.
+func closeEvents(t *testing.T, conf HandlerConf, f func(h Handler)) []string {
+	registerTestCloser.Do(func() {
+		err := RegisterHandler("test_closer", func(args []interface{}) (Handler, error) {
+			return &testCloser{name: args[0].(string)}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	h, err := MakeHandler(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := Root().GetHandler()
+	defer Root().SetHandler(old)
+	Root().SetHandler(h)
+
+	closeLog.Lock()
+	closeLog.events = nil
+	closeLog.Unlock()
+
+	f(h)
+
+	closeLog.Lock()
+	defer closeLog.Unlock()
+	return closeLog.events
+}
+
+func equalEvents(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestCloseWalksInstalledTree checks that Close flushes and closes the
+// sinks of the installed handler, through the handlers wrapping them,
+// and nothing else
+func TestCloseWalksInstalledTree(t *testing.T) {
+	conf := HandlerConf{"level_filter", "info",
+		HandlerConf{"async", 10, "block", HandlerConf{"test_closer", "file"}},
+	}
+
+	events := closeEvents(t, conf, func(Handler) {
+		// neither installed nor closed
+		if _, err := MakeHandler(HandlerConf{"test_closer", "unused"}); err != nil {
+			t.Fatal(err)
+		}
+		Close()
+	})
+
+	if want := []string{"flush file", "close file"}; !equalEvents(events, want) {
+		t.Errorf("expected %v, got %v", want, events)
+	}
+}
+
+// TestCloseSkipsSwappedOut checks that Close leaves alone a handler that
+// was installed and then replaced
+func TestCloseSkipsSwappedOut(t *testing.T) {
+	events := closeEvents(t, HandlerConf{"swappable", HandlerConf{"test_closer", "old"}}, func(h Handler) {
+		nh, err := MakeHandler(HandlerConf{"test_closer", "new"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.(*SwappableHandler).Swap(nh)
+		Close()
+	})
+
+	if want := []string{"flush new", "close new"}; !equalEvents(events, want) {
+		t.Errorf("expected %v, got %v", want, events)
+	}
+}
+
+// TestCloseRotatingFiles checks that Close closes the files of the
+// rotating handlers built from a conf
+func TestCloseRotatingFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+
+	for _, conf := range []HandlerConf{
+		{"rotating_file", path, "json", 1000, 3, true, "1h"},
+		{"timed_rotating_file", path, "json", "daily", true},
+	} {
+		h, err := MakeHandler(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		old := Root().GetHandler()
+		Root().SetHandler(h)
+		Root().Info("hello")
+		Close()
+		Root().SetHandler(old)
+
+		if open := openFilesIn(t, dir); len(open) != 0 {
+			t.Errorf("%v: left open %v", conf, open)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package log
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CloudWatchFlushInterval is how often a CloudWatchHandler sends the
+// records gathered since its last send
+var CloudWatchFlushInterval = 5 * time.Second
+
+// CloudWatchBufferSize is the number of records a CloudWatchHandler holds
+// between sends. When it is full the oldest are dropped.
+var CloudWatchBufferSize = 10000
+
+// CloudWatchRetries is the number of times a failed PutLogEvents is
+// retried, waiting twice as long before each retry starting from
+// CloudWatchRetryBackoff up to CloudWatchMaxBackoff. Throttled calls are
+// retried for as long as the handler is open.
+var (
+	CloudWatchRetries      = 5
+	CloudWatchRetryBackoff = 200 * time.Millisecond
+	CloudWatchMaxBackoff   = 30 * time.Second
+)
+
+// the PutLogEvents limits. each event counts 26 bytes on top of its message
+const (
+	cwMaxBatchBytes  = 1048576
+	cwMaxBatchEvents = 10000
+	cwMaxBatchSpan   = 24 * time.Hour
+	cwEventOverhead  = 26
+	cwMaxEventBytes  = 262144 - cwEventOverhead
+)
+
+// CloudWatchHandler sends formatted records to an AWS CloudWatch Logs
+// stream. Records are gathered and sent every CloudWatchFlushInterval in
+// PutLogEvents calls that keep to CloudWatch's limits of 10000 events and
+// 1MB a call; longer records are truncated to CloudWatch's 256KB. Up to
+// CloudWatchBufferSize records are held between sends, eg: while calls
+// are throttled. Records dropped because the buffer was full or that
+// can't be delivered are counted (see Dropped).
+//
+// AWS credentials are taken from the environment like the AWS SDKs do:
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN (as set
+// in Lambda), or else the ECS container credentials endpoint. The API
+// endpoint can be overridden with AWS_ENDPOINT_URL_CLOUDWATCH_LOGS or
+// AWS_ENDPOINT_URL, eg: for localstack.
+type CloudWatchHandler struct {
+	Group  string
+	Stream string
+	Region string
+
+	fmtr     Format
+	client   *http.Client
+	endpoint string
+	creds    *awsCredentials
+	seqToken string // only used by flush
+
+	mu      sync.Mutex
+	pending []cwEvent
+	dropped uint64
+	closing int32
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type cwEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// MakeCloudWatchHandler prepares a handler sending records formatted
+// with @fmtr to the log @stream of the log @group in @region ("" for
+// AWS_REGION). The group and the stream are created if they don't exist.
+func MakeCloudWatchHandler(group, stream, region string, fmtr Format) (*CloudWatchHandler, error) {
+	if group == "" || stream == "" {
+		return nil, fmt.Errorf("%w: cloudwatch: expected a log group and stream", BadConf)
+	}
+
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("%w: cloudwatch: no region given nor in AWS_REGION", BadConf)
+	}
+
+	p := &CloudWatchHandler{
+		Group:    group,
+		Stream:   stream,
+		Region:   region,
+		fmtr:     fmtr,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		endpoint: cloudWatchEndpoint(region),
+		creds:    &awsCredentials{client: &http.Client{Timeout: 5 * time.Second}},
+		done:     make(chan struct{}),
+	}
+
+	if err := p.createGroup(); err != nil {
+		return nil, err
+	}
+	if err := p.createStream(); err != nil {
+		return nil, err
+	}
+
+	p.wg.Add(1)
+	go p.flushPeriodically(p.done)
+
+	return p, nil
+}
+
+func (p *CloudWatchHandler) Log(r *log15.Record) error {
+	msg := strings.TrimRight(string(p.fmtr.Format(r)), "\n")
+	if len(msg) > cwMaxEventBytes {
+		msg = strings.ToValidUTF8(msg[:cwMaxEventBytes], "")
+	}
+	ev := cwEvent{Timestamp: r.Time.UnixNano() / int64(time.Millisecond), Message: msg}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done == nil {
+		atomic.AddUint64(&p.dropped, 1)
+		return nil
+	}
+
+	max := CloudWatchBufferSize
+	if max < 1 {
+		max = 1
+	}
+	if n := len(p.pending) - max + 1; n > 0 {
+		// full; drop the oldest records to make room
+		p.pending = p.pending[n:]
+		atomic.AddUint64(&p.dropped, uint64(n))
+	}
+
+	p.pending = append(p.pending, ev)
+	return nil
+}
+
+func (p *CloudWatchHandler) flushPeriodically(done chan struct{}) {
+	defer p.wg.Done()
+
+	t := time.NewTicker(CloudWatchFlushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			p.flush()
+			return
+		case <-t.C:
+			p.flush()
+		}
+	}
+}
+
+// flush sends all pending records in batches within the PutLogEvents
+// limits. The events of a batch must be in chronological order.
+func (p *CloudWatchHandler) flush() {
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].Timestamp < pending[j].Timestamp
+	})
+
+	span := cwMaxBatchSpan.Milliseconds()
+	for len(pending) > 0 {
+		n, size := 0, 0
+		for n < len(pending) && n < cwMaxBatchEvents {
+			evSize := len(pending[n].Message) + cwEventOverhead
+			if size+evSize > cwMaxBatchBytes || pending[n].Timestamp-pending[0].Timestamp >= span {
+				break
+			}
+			size += evSize
+			n++
+		}
+
+		if err := p.put(pending[:n]); err != nil {
+			atomic.AddUint64(&p.dropped, uint64(n))
+		}
+		pending = pending[n:]
+	}
+}
+
+// put sends @events, retrying throttled and failed calls
+func (p *CloudWatchHandler) put(events []cwEvent) error {
+	backoff := CloudWatchRetryBackoff
+	for attempt := 0; ; attempt++ {
+		req := map[string]interface{}{
+			"logGroupName":  p.Group,
+			"logStreamName": p.Stream,
+			"logEvents":     events,
+		}
+		if p.seqToken != "" {
+			req["sequenceToken"] = p.seqToken
+		}
+
+		var resp struct {
+			NextSequenceToken string `json:"nextSequenceToken"`
+		}
+		err := p.call("PutLogEvents", req, &resp)
+		if err == nil {
+			p.seqToken = resp.NextSequenceToken
+			return nil
+		}
+
+		cwErr, ok := err.(*cloudWatchError)
+		switch {
+		case ok && cwErr.is("DataAlreadyAcceptedException"):
+			p.seqToken = cwErr.ExpectedSequenceToken
+			return nil
+		case ok && cwErr.is("InvalidSequenceTokenException"):
+			// not a failure, try again right away with the right token
+			p.seqToken = cwErr.ExpectedSequenceToken
+			if attempt < CloudWatchRetries {
+				continue
+			}
+		case ok && cwErr.is("ResourceNotFoundException"):
+			// the stream was deleted under us
+			p.seqToken = ""
+			if e := p.createStream(); e != nil {
+				return e
+			}
+		case ok && cwErr.is("ThrottlingException") && atomic.LoadInt32(&p.closing) == 0:
+			// never give up on throttling while open
+			attempt = 0
+		case ok && !cwErr.retryable():
+			return err
+		}
+
+		if attempt >= CloudWatchRetries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > CloudWatchMaxBackoff {
+			backoff = CloudWatchMaxBackoff
+		}
+	}
+}
+
+func (p *CloudWatchHandler) createGroup() error {
+	err := p.call("CreateLogGroup", map[string]string{"logGroupName": p.Group}, nil)
+	if cwErr, ok := err.(*cloudWatchError); ok && cwErr.is("ResourceAlreadyExistsException") {
+		return nil
+	}
+	return err
+}
+
+func (p *CloudWatchHandler) createStream() error {
+	err := p.call("CreateLogStream", map[string]string{
+		"logGroupName":  p.Group,
+		"logStreamName": p.Stream,
+	}, nil)
+	if cwErr, ok := err.(*cloudWatchError); ok && cwErr.is("ResourceAlreadyExistsException") {
+		return nil
+	}
+	return err
+}
+
+// cloudWatchError is an error answered by the CloudWatch Logs API
+type cloudWatchError struct {
+	Status                int
+	Type                  string `json:"__type"`
+	Message               string `json:"message"`
+	ExpectedSequenceToken string `json:"expectedSequenceToken"`
+}
+
+func (e *cloudWatchError) Error() string {
+	return fmt.Sprintf("log: cloudwatch: %d %s: %s", e.Status, e.Type, e.Message)
+}
+
+// is tells if @e is of the exception @name. Types may come prefixed
+// with a namespace, eg: "com.amazonaws.logs#ThrottlingException".
+func (e *cloudWatchError) is(name string) bool {
+	return e.Type == name || strings.HasSuffix(e.Type, "#"+name)
+}
+
+// retryable tells if the call may succeed when made again
+func (e *cloudWatchError) retryable() bool {
+	return e.Status >= 500 || e.is("ThrottlingException") || e.is("ServiceUnavailableException")
+}
+
+// call makes the CloudWatch Logs API call @action with the JSON
+// encoding of @in, decoding the answer into @out unless it is nil
+func (p *CloudWatchHandler) call(action string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	creds, err := p.creds.get()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "Logs_20140328."+action)
+	signAWSRequest(req, body, p.Region, "logs", creds, time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		cwErr := &cloudWatchError{Status: resp.StatusCode}
+		if json.Unmarshal(b, cwErr) != nil || cwErr.Type == "" {
+			cwErr.Type, cwErr.Message = resp.Status, string(b)
+		}
+		return cwErr
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+// Dropped returns the number of records that could not be delivered
+func (p *CloudWatchHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close sends the pending records and stops the handler.
+// It is safe to call Close more than once.
+func (p *CloudWatchHandler) Close() error {
+	p.mu.Lock()
+	done := p.done
+	p.done = nil
+	p.mu.Unlock()
+
+	if done != nil {
+		atomic.StoreInt32(&p.closing, 1)
+		close(done)
+		p.wg.Wait()
+	}
+	return nil
+}
+
+// cloudWatchEndpoint returns the URL of the CloudWatch Logs API in @region
+func cloudWatchEndpoint(region string) string {
+	for _, env := range []string{"AWS_ENDPOINT_URL_CLOUDWATCH_LOGS", "AWS_ENDPOINT_URL"} {
+		if u := os.Getenv(env); u != "" {
+			return u
+		}
+	}
+
+	domain := "amazonaws.com"
+	if strings.HasPrefix(region, "cn-") {
+		domain = "amazonaws.com.cn"
+	}
+	return "https://logs." + region + "." + domain + "/"
+}
+
+type awsCreds struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// awsCredentials gets AWS credentials from the environment or the ECS
+// container credentials endpoint, caching the latter until they expire
+type awsCredentials struct {
+	client *http.Client
+
+	mu     sync.Mutex
+	cached awsCreds
+}
+
+func (p *awsCredentials) get() (awsCreds, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCreds{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Token:           os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	u := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if rel := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); rel != "" {
+		u = "http://169.254.170.2" + rel
+	}
+	if u == "" {
+		return awsCreds{}, fmt.Errorf("%w: cloudwatch: no AWS credentials in the environment", BadConf)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cached.AccessKeyID != "" && time.Until(p.cached.Expiration) > 5*time.Minute {
+		return p.cached, nil
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return awsCreds{}, err
+	}
+	if tok := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); tok != "" {
+		req.Header.Set("Authorization", tok)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return awsCreds{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return awsCreds{}, fmt.Errorf("log: cloudwatch: container credentials: %s", resp.Status)
+	}
+
+	var c awsCreds
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return awsCreds{}, err
+	}
+
+	p.cached = c
+	return c, nil
+}
+
+// signAWSRequest adds AWS Signature Version 4 headers to @req, whose
+// body is @body, for @service in @region
+func signAWSRequest(req *http.Request, body []byte, region, service string, c awsCreds, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.Token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	bodyHash := sha256.Sum256(body)
+	canonReq := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonHeaders.String(),
+		signed,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonHash := sha256.Sum256([]byte(canonReq))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonHash[:])
+
+	key := []byte("AWS4" + c.SecretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.AccessKeyID, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
@@ -0,0 +1,28 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCloudWatchBufferFull checks that a full buffer drops and counts its
+// oldest records
+func TestCloudWatchBufferFull(t *testing.T) {
+	size := CloudWatchBufferSize
+	CloudWatchBufferSize = 2
+	defer func() { CloudWatchBufferSize = size }()
+
+	p := &CloudWatchHandler{fmtr: log15.LogfmtFormat(), done: make(chan struct{})}
+	for _, msg := range []string{"a", "b", "c"} {
+		p.Log(&log15.Record{Time: time.Now(), Lvl: log15.LvlInfo, Msg: msg, KeyNames: log15.RecordKeyNames{Time: "t", Lvl: "lvl", Msg: "msg"}})
+	}
+
+	if n := p.Dropped(); n != 1 {
+		t.Errorf("expected 1 dropped record, got %d", n)
+	}
+	if len(p.pending) != 2 || !strings.HasSuffix(p.pending[0].Message, "msg=b") || !strings.HasSuffix(p.pending[1].Message, "msg=c") {
+		t.Errorf("expected records b and c, got %v", p.pending)
+	}
+}
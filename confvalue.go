@@ -0,0 +1,156 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// makeHandlerFromValue builds the handler described by @v, a handler conf
+// decoded from a config file (see MakeHandlerFromJSON)
+func makeHandlerFromValue(v interface{}) (Handler, error) {
+	c, err := toConf(v, "$", false)
+	if err != nil {
+		return nil, err
+	}
+
+	conf, ok := c.(HandlerConf)
+	if !ok {
+		return nil, fmt.Errorf("%w: $: expected [name, args...]", BadConf)
+	}
+
+	return MakeHandler(conf)
+}
+
+// toConf converts the decoded value @v found at @path to what MakeHandler
+// expects. @firstArg tells if @v is the first argument of a handler or format.
+func toConf(v interface{}, path string, firstArg bool) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, fmt.Errorf("%w: %s: null is not allowed", BadConf, path)
+
+	case json.Number:
+		if i, err := strconv.Atoi(v.String()); err == nil {
+			return i, nil
+		}
+
+		f, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: bad number %s", BadConf, path, v)
+		}
+		return f, nil
+
+	case []interface{}:
+		if len(v) == 0 {
+			return nil, fmt.Errorf("%w: %s: expected [name, args...]", BadConf, path)
+		}
+
+		name, ok := v[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s[0]: expected a handler or format name", BadConf, path)
+		}
+
+		if !isConfName(name) {
+			if strs, ok := toStrings(v); ok && firstArg {
+				return strs, nil
+			}
+			return nil, fmt.Errorf("%w: %s[0]: unknown handler or format %q", BadConf, path, name)
+		}
+
+		conf := make(HandlerConf, len(v))
+		for i, e := range v {
+			c, err := toConf(e, fmt.Sprintf("%s[%d]", path, i), i == 1)
+			if err != nil {
+				return nil, err
+			}
+			conf[i] = c
+		}
+		return conf, nil
+
+	case map[string]interface{}:
+		return toConfMap(v, path)
+
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ks, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s: key %v is not a string", BadConf, path, k)
+			}
+			m[ks] = e
+		}
+		return toConfMap(m, path)
+	}
+
+	// strings, ints, floats and bools
+	return v, nil
+}
+
+// toConfMap converts the decoded object @v found at @path
+func toConfMap(v map[string]interface{}, path string) (interface{}, error) {
+	var nstrs, nnums, nconfs int
+	m := make(map[string]interface{}, len(v))
+	for k, e := range v {
+		c, err := toConf(e, fmt.Sprintf("%s.%s", path, k), false)
+		if err != nil {
+			return nil, err
+		}
+
+		switch c.(type) {
+		case string:
+			nstrs++
+		case int, float64:
+			nnums++
+		case HandlerConf:
+			nconfs++
+		}
+		m[k] = c
+	}
+
+	switch len(m) {
+	case nstrs:
+		strs := make(map[string]string, len(m))
+		for k, c := range m {
+			strs[k] = c.(string)
+		}
+		return strs, nil
+
+	case nnums:
+		nums := make(map[string]float64, len(m))
+		for k, c := range m {
+			if i, ok := c.(int); ok {
+				nums[k] = float64(i)
+			} else {
+				nums[k] = c.(float64)
+			}
+		}
+		return nums, nil
+
+	case nconfs:
+		confs := make(map[string]HandlerConf, len(m))
+		for k, c := range m {
+			confs[k] = c.(HandlerConf)
+		}
+		return confs, nil
+	}
+	return m, nil
+}
+
+// toStrings returns @v as a []string if all its elements are strings
+func toStrings(v []interface{}) ([]string, bool) {
+	strs := make([]string, len(v))
+	for i, e := range v {
+		s, ok := e.(string)
+		if !ok {
+			return nil, false
+		}
+		strs[i] = s
+	}
+	return strs, true
+}
+
+// isConfName tells if @name is a handler or format MakeHandler knows
+func isConfName(name string) bool {
+	return builtinHandlers[name] || builtinFormatters[name] ||
+		registeredHandler(name) != nil || registeredFormatter(name) != nil
+}
@@ -0,0 +1,66 @@
+package log
+
+import (
+	"context"
+	"sort"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	ctxKey
+)
+
+// NewContext returns a copy of @ctx carrying @l, to be retrieved with
+// FromContext further down the call chain
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// ContextWithCtx returns a copy of @ctx carrying the fields of @c merged
+// over those already in @ctx. The logger returned by FromContext adds
+// them to every record, eg: a middleware can do
+//	r = r.WithContext(log.ContextWithCtx(r.Context(), log.Ctx{"trace_id": id}))
+// and every handler then logs the trace_id with
+//	log.FromContext(r.Context()).Info("fetched", "rows", n)
+func ContextWithCtx(ctx context.Context, c Ctx) context.Context {
+	merged := Ctx{}
+	if prev, ok := ctx.Value(ctxKey).(Ctx); ok {
+		for k, v := range prev {
+			merged[k] = v
+		}
+	}
+	for k, v := range c {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, ctxKey, merged)
+}
+
+// FromContext returns the logger carried by @ctx (see NewContext), or
+// Root() if there is none, with the fields added by ContextWithCtx
+func FromContext(ctx context.Context) Logger {
+	l, ok := ctx.Value(loggerKey).(Logger)
+	if !ok {
+		l = Root()
+	}
+
+	c, _ := ctx.Value(ctxKey).(Ctx)
+	if len(c) == 0 {
+		return l
+	}
+
+	// sorted for a stable order of fields
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k, c[k])
+	}
+	return l.New(pairs...)
+}
@@ -0,0 +1,72 @@
+package log
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// CSVFormat renders each record as an RFC4180 CSV row with the given
+// @columns. The columns "t", "lvl" and "msg" are the record's time
+// (RFC3339), level and message; any other column is taken from the ctx
+// field of that name, left empty if the record doesn't have it.
+//
+// With @header set, a row of the column names is written before the
+// first record rendered by this format, ie: once per process per
+// handler. Appending to an existing file thus repeats the header, which
+// is why it is off by default.
+func CSVFormat(columns []string, header bool) Format {
+	var once sync.Once
+
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		b := &bytes.Buffer{}
+		w := csv.NewWriter(b)
+
+		if header {
+			once.Do(func() { w.Write(columns) })
+		}
+
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			switch col {
+			case "t":
+				row[i] = r.Time.Format(time.RFC3339)
+				continue
+			case "lvl":
+				row[i] = r.Lvl.String()
+				continue
+			case "msg":
+				row[i] = r.Msg
+				continue
+			}
+
+			for j := 0; j+1 < len(r.Ctx); j += 2 {
+				if r.Ctx[j] == col {
+					row[i] = csvValue(r.Ctx[j+1])
+					break
+				}
+			}
+		}
+
+		w.Write(row)
+		w.Flush()
+		return b.Bytes()
+	})
+}
+
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%+v", v)
+}
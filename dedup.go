@@ -0,0 +1,115 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DedupHandler returns a handler that suppresses a record identical to
+// the one before it (same level, message and ctx, in any key order) if
+// it comes within @window of it, like syslog's "last message repeated N
+// times". When the run of repeats ends, ie: a different record arrives
+// or one comes after @window, the last repeat is forwarded with
+// repeated=N added, N being the number of records suppressed. The
+// handler is Flushable, so that a run still going on is forwarded the
+// same way by Flush, and by Close before closing @h.
+func DedupHandler(window time.Duration, h Handler) Handler {
+	return &dedupHandler{window: window, h: h}
+}
+
+type dedupHandler struct {
+	window time.Duration
+	h      Handler
+
+	mu       sync.Mutex
+	lastFP   string
+	lastTime time.Time
+	repeat   *log15.Record // last suppressed record
+	repeated int
+}
+
+func (p *dedupHandler) Log(r *log15.Record) error {
+	fp := fingerprint(r)
+
+	p.mu.Lock()
+	now := Now()
+	if fp == p.lastFP && now.Sub(p.lastTime) < p.window {
+		rc := *r
+		p.repeat = &rc
+		p.repeated++
+		p.lastTime = now
+		p.mu.Unlock()
+		return nil
+	}
+
+	prev, n := p.take()
+	p.lastFP, p.lastTime = fp, now
+	p.mu.Unlock()
+
+	if n > 0 {
+		p.logRepeat(prev, n)
+	}
+
+	return p.h.Log(r)
+}
+
+// take returns the last suppressed record and the number
+// suppressed, ending the run of repeats
+func (p *dedupHandler) take() (*log15.Record, int) {
+	prev, n := p.repeat, p.repeated
+	p.repeat, p.repeated = nil, 0
+	return prev, n
+}
+
+// logRepeat forwards @r, the last of @n suppressed records, with repeated=@n
+func (p *dedupHandler) logRepeat(r *log15.Record, n int) error {
+	r.Ctx = append(r.Ctx[:len(r.Ctx):len(r.Ctx)], "repeated", n)
+	return p.h.Log(r)
+}
+
+// Flush forwards the run of repeats going on, if any, as it would be
+// when it ends. A record identical to the last one is then forwarded
+// as the start of a new run.
+func (p *dedupHandler) Flush() error {
+	p.mu.Lock()
+	prev, n := p.take()
+	if n > 0 {
+		p.lastFP = ""
+	}
+	p.mu.Unlock()
+
+	if n == 0 {
+		return nil
+	}
+	return p.logRepeat(prev, n)
+}
+
+// Close flushes the handler, then flushes and closes
+// the wrapped handler if it needs it
+func (p *dedupHandler) Close() error {
+	err := p.Flush()
+	if e := closeTree(p.h); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// fingerprint identifies a record by its level, message
+// and ctx, independent of the order of the ctx keys
+func fingerprint(r *log15.Record) string {
+	pairs := make([]string, 0, (len(r.Ctx)+1)/2)
+	for i := 0; i < len(r.Ctx); i += 2 {
+		if i+1 < len(r.Ctx) {
+			pairs = append(pairs, fmt.Sprintf("%v=%+v", r.Ctx[i], r.Ctx[i+1]))
+		} else {
+			pairs = append(pairs, fmt.Sprintf("%v", r.Ctx[i]))
+		}
+	}
+	sort.Strings(pairs)
+
+	return fmt.Sprintf("%d\x00%s\x00%s", r.Lvl, r.Msg, strings.Join(pairs, "\x00"))
+}
@@ -0,0 +1,41 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"testing"
+	"time"
+)
+
+// TestDedupCloseLogsRepeats checks that closing the handler forwards
+// the run of repeats still going on
+func TestDedupCloseLogsRepeats(t *testing.T) {
+	var logged []string
+	sink := log15.FuncHandler(func(r *log15.Record) error {
+		logged = append(logged, fmt.Sprint(r.Msg, r.Ctx))
+		return nil
+	})
+
+	h := DedupHandler(time.Minute, sink)
+	for i := 0; i < 3; i++ {
+		h.Log(&log15.Record{Lvl: log15.LvlWarn, Msg: "disk full", Ctx: []interface{}{"dev", "sda"}})
+	}
+	if len(logged) != 1 {
+		t.Fatalf("expected the repeats suppressed, got %v", logged)
+	}
+
+	if err := closeTree(h); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"disk full[dev sda]", "disk full[dev sda repeated 2]"}
+	if fmt.Sprint(logged) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, logged)
+	}
+
+	// nothing is left to forward
+	closeTree(h)
+	if len(logged) != 2 {
+		t.Errorf("expected no more records, got %v", logged)
+	}
+}
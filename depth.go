@@ -0,0 +1,183 @@
+package log
+
+import (
+	"encoding/json"
+	"gopkg.in/inconshreveable/log15.v2"
+	"reflect"
+	"strings"
+)
+
+// TruncatedMarker replaces ctx values nested deeper than allowed
+// by the "max_depth" handler and JSONOptions.MaxDepth
+const TruncatedMarker = "<truncated>"
+
+// MaxDepthHandler returns a handler that bounds the nesting of ctx values
+// (maps, slices, arrays, structs and pointers to them) to @depth levels,
+// replacing anything deeper with TruncatedMarker, before passing records
+// on to @h. With @depth 1 a flat map is kept as is but a map inside it is
+// truncated. @depth <= 0 means unlimited.
+func MaxDepthHandler(depth int, h Handler) Handler {
+	if depth <= 0 {
+		return h
+	}
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		return h.Log(truncateCtx(r, depth))
+	})
+}
+
+// truncateCtx returns @r, or a copy of it if any of its ctx
+// values are nested deeper than @depth
+func truncateCtx(r *log15.Record, depth int) *log15.Record {
+	var rc *log15.Record
+	for i := 1; i < len(r.Ctx); i += 2 {
+		if !tooDeep(reflect.ValueOf(r.Ctx[i]), depth) {
+			continue
+		}
+
+		if rc == nil {
+			c := *r
+			c.Ctx = append([]interface{}(nil), r.Ctx...)
+			rc = &c
+		}
+		rc.Ctx[i] = truncateValue(reflect.ValueOf(r.Ctx[i]), depth)
+	}
+
+	if rc == nil {
+		return r
+	}
+	return rc
+}
+
+// nested tells if @v is a container whose contents count as a level
+func nested(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		// values that render themselves are leaves
+		if v.CanInterface() {
+			switch v.Interface().(type) {
+			case json.Marshaler, error:
+				return false
+			}
+		}
+		return v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// deref follows pointers and interfaces down to the value they hold
+func deref(v reflect.Value) reflect.Value {
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		if v.Kind() == reflect.Ptr && v.CanInterface() {
+			if _, ok := v.Interface().(json.Marshaler); ok {
+				return v
+			}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// tooDeep tells if @v nests more than @depth levels
+func tooDeep(v reflect.Value, depth int) bool {
+	v = deref(v)
+	if !nested(v) {
+		return false
+	}
+	if depth <= 0 {
+		return true
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if tooDeep(iter.Value(), depth-1) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if tooDeep(v.Index(i), depth-1) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() && tooDeep(v.Field(i), depth-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// truncateValue rebuilds @v as plain maps and slices, cutting it
+// off with TruncatedMarker below @depth levels. Struct fields are
+// keyed by their json name as encoding/json would.
+func truncateValue(v reflect.Value, depth int) interface{} {
+	v = deref(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if !nested(v) {
+		if v.CanInterface() {
+			return v.Interface()
+		}
+		return nil
+	}
+	if depth <= 0 {
+		return TruncatedMarker
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmtKey(iter.Key())] = truncateValue(iter.Value(), depth-1)
+		}
+		return m
+
+	case reflect.Slice, reflect.Array:
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = truncateValue(v.Index(i), depth-1)
+		}
+		return s
+
+	default: // reflect.Struct
+		m := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			name := f.Name
+			if tag := f.Tag.Get("json"); tag != "" {
+				if tag == "-" {
+					continue
+				}
+				if n := strings.Split(tag, ",")[0]; n != "" {
+					name = n
+				}
+			}
+			m[name] = truncateValue(v.Field(i), depth-1)
+		}
+		return m
+	}
+}
+
+// fmtKey renders a map key as encoding/json would
+func fmtKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+
+	b, err := json.Marshal(k.Interface())
+	if err != nil {
+		return TruncatedMarker
+	}
+	return strings.Trim(string(b), `"`)
+}
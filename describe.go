@@ -0,0 +1,73 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// DescribeConf returns a human readable tree of the handlers that
+// @conf would produce, one handler per line with its children indented
+// below it, eg:
+//
+//	level_filter "debug"
+//	  multi
+//	    file "/tmp/test.log" format=json
+//	    stream "stderr" format=terminal
+//
+// It works purely from the conf; no handler is constructed and nothing
+// is opened or dialled, so it is safe to use for previewing configs. Only
+// the structure of @conf is checked, not the arguments of each handler.
+func DescribeConf(conf HandlerConf) (string, error) {
+	b := &bytes.Buffer{}
+	if err := describeConf(b, conf, 0); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func describeConf(b *bytes.Buffer, conf HandlerConf, depth int) error {
+	if len(conf) < 1 {
+		return fmt.Errorf("%w: handler: empty conf", BadConf)
+	}
+
+	name, ok := conf[0].(string)
+	if !ok {
+		return fmt.Errorf("%w: handler: expected name string, got %T", BadConf, conf[0])
+	}
+
+	var children []HandlerConf
+
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(name)
+	for _, arg := range conf[1:] {
+		if child, ok := arg.(HandlerConf); ok {
+			// formats are side effect free to construct, so
+			// use that to tell a format apart from a handler
+			if _, err := MakeFormatter(child); err == nil {
+				fmt.Fprintf(b, " format=%v", []interface{}(child))
+			} else {
+				children = append(children, child)
+			}
+			continue
+		}
+
+		if s, ok := arg.(string); ok {
+			if _, err := MakeFormatter(s); err == nil {
+				fmt.Fprintf(b, " format=%s", s)
+				continue
+			}
+		}
+
+		fmt.Fprintf(b, " %#v", arg)
+	}
+	b.WriteByte('\n')
+
+	for _, child := range children {
+		if err := describeConf(b, child, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DictCompressMaxEntries bounds the dictionary of a "dict_compress"
+// handler. Once it is full the dictionary is reset.
+var DictCompressMaxEntries = 4096
+
+// DictCompressHandler returns an experimental handler that shrinks
+// records sharing the same values for the ctx fields @keys (eg: the
+// request metadata repeated on every record of a request) before passing
+// them on to @h, typically a "net" handler on a constrained link.
+//
+// Wire protocol, as seen in the ctx of the records passed on:
+//
+//	dict_id=N followed by the fields of the set
+//		defines (or redefines) entry N as those fields
+//	dict_ref=N in place of the fields of the set
+//		the record carried the fields of entry N
+//
+// The first record with a given field set defines it; later ones refer
+// to it. An entry is defined again once @resync has passed since it was
+// last sent in full so that consumers joining late can catch up; until
+// they see a definition they can't expand references to it. Ids are
+// never reused within a process, so when the dictionary reaches
+// DictCompressMaxEntries it is simply emptied and sets get new ids
+// (and definitions) as they are seen again. Records without any of @keys
+// pass through unchanged.
+func DictCompressHandler(keys []string, resync time.Duration, h Handler) Handler {
+	type entry struct {
+		id   uint64
+		sent time.Time
+	}
+
+	var (
+		mu     sync.Mutex
+		dict   = make(map[string]*entry)
+		nextID uint64
+	)
+
+	inSet := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		inSet[k] = true
+	}
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		var set, rest []interface{}
+		fp := &strings.Builder{}
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			k, ok := r.Ctx[i].(string)
+			if !ok || !inSet[k] {
+				rest = append(rest, r.Ctx[i], r.Ctx[i+1])
+				continue
+			}
+
+			set = append(set, k, r.Ctx[i+1])
+			fp.WriteString(k)
+			fp.WriteByte('=')
+			fp.WriteString(formatLogfmtValue(r.Ctx[i+1]))
+			fp.WriteByte(0)
+		}
+
+		if len(set) == 0 {
+			return h.Log(r)
+		}
+
+		mu.Lock()
+		now := Now()
+		e, found := dict[fp.String()]
+		if !found {
+			if len(dict) >= DictCompressMaxEntries {
+				dict = make(map[string]*entry)
+			}
+
+			nextID++
+			e = &entry{id: nextID}
+			dict[fp.String()] = e
+		}
+
+		define := !found || now.Sub(e.sent) >= resync
+		if define {
+			e.sent = now
+		}
+		id := e.id
+		mu.Unlock()
+
+		rc := *r
+		if define {
+			rc.Ctx = append(append(rest, "dict_id", id), set...)
+		} else {
+			rc.Ctx = append(rest, "dict_ref", id)
+		}
+
+		return h.Log(&rc)
+	})
+}
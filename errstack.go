@@ -0,0 +1,115 @@
+package log
+
+import (
+	"errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"reflect"
+	"runtime"
+)
+
+// ErrorStackKey is the ctx key under which ErrorStackHandler
+// attaches the stack trace of a logged error
+const ErrorStackKey = "error_stack"
+
+// ErrorStackHandler returns a handler that looks for an error carrying a
+// stack trace among the ctx values of each record and adds that trace
+// under ErrorStackKey as a slice of StackFrame, most recent call first,
+// so that JSON formats emit it as an array of {file, line, func}
+// objects. Errors with a
+//	StackTrace() T
+// method returning a slice of program counters (eg: those of
+// github.com/pkg/errors) or a
+//	Callers() []uintptr
+// method are understood, as are such errors wrapped by others. The
+// innermost stack in the chain is used, being closest to where the error
+// originated. Only the first error with a stack in a record is traced.
+func ErrorStackHandler(h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		for i := 1; i < len(r.Ctx); i += 2 {
+			err, ok := r.Ctx[i].(error)
+			if !ok {
+				continue
+			}
+
+			pcs := errorPCs(err)
+			if len(pcs) == 0 {
+				continue
+			}
+
+			rc := *r
+			rc.Ctx = append(r.Ctx[:len(r.Ctx):len(r.Ctx)], ErrorStackKey, stackFrames(pcs))
+			return h.Log(&rc)
+		}
+
+		return h.Log(r)
+	})
+}
+
+// errorPCs returns the innermost stack trace carried by the chain of
+// errors starting at @err, as program counters
+func errorPCs(err error) []uintptr {
+	var pcs []uintptr
+	for ; err != nil; err = unwrapError(err) {
+		if s := stackOf(err); len(s) > 0 {
+			pcs = s
+		}
+	}
+	return pcs
+}
+
+// unwrapError returns the error wrapped by @err, understanding
+// both errors.Unwrap and github.com/pkg/errors' Cause
+func unwrapError(err error) error {
+	if next := errors.Unwrap(err); next != nil {
+		return next
+	}
+	if c, ok := err.(interface{ Cause() error }); ok {
+		if next := c.Cause(); next != err {
+			return next
+		}
+	}
+	return nil
+}
+
+// stackOf returns the program counters of @err's own stack trace
+func stackOf(err error) []uintptr {
+	if c, ok := err.(interface{ Callers() []uintptr }); ok {
+		return c.Callers()
+	}
+
+	// the type returned by StackTrace varies by package (eg:
+	// errors.StackTrace, a []errors.Frame of uintptr), so go by its kind
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() {
+		return nil
+	}
+
+	t := m.Type()
+	if t.NumIn() != 0 || t.NumOut() != 1 ||
+		t.Out(0).Kind() != reflect.Slice || t.Out(0).Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+
+	s := m.Call(nil)[0]
+	pcs := make([]uintptr, s.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(s.Index(i).Uint())
+	}
+	return pcs
+}
+
+// stackFrames resolves @pcs, as returned by runtime.Callers, to frames
+func stackFrames(pcs []uintptr) []StackFrame {
+	res := make([]StackFrame, 0, len(pcs))
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" || f.File != "" {
+			res = append(res, StackFrame{File: f.File, Line: f.Line, Func: f.Function})
+		}
+		if !more {
+			break
+		}
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// EscalateRepeatHandler returns a handler that relabels records of
+// level @from to level @to once the same message has been logged
+// @threshold times within @window, adding escalated=true to them. The
+// window is fixed, not sliding: the count for a message starts over at
+// the first occurrence after a whole @window has passed since the one
+// that started it, even if the message kept repeating all along.
+func EscalateRepeatHandler(threshold int, window time.Duration, from, to Lvl, h Handler) Handler {
+	type run struct {
+		start time.Time
+		count int
+	}
+
+	var (
+		mu        sync.Mutex
+		runs      = make(map[string]*run)
+		lastSweep = Now()
+	)
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		if Lvl(r.Lvl) != from {
+			return h.Log(r)
+		}
+
+		mu.Lock()
+		now := Now()
+		if now.Sub(lastSweep) >= window {
+			for msg, rn := range runs {
+				if now.Sub(rn.start) >= window {
+					delete(runs, msg)
+				}
+			}
+			lastSweep = now
+		}
+
+		rn, ok := runs[r.Msg]
+		if !ok || now.Sub(rn.start) >= window {
+			rn = &run{start: now}
+			runs[r.Msg] = rn
+		}
+		rn.count++
+		escalate := rn.count >= threshold
+		mu.Unlock()
+
+		if !escalate {
+			return h.Log(r)
+		}
+
+		rc := *r
+		rc.Lvl = log15.Lvl(to)
+		rc.Ctx = append(r.Ctx[:len(r.Ctx):len(r.Ctx)], "escalated", true)
+		return h.Log(&rc)
+	})
+}
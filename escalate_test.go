@@ -0,0 +1,42 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"testing"
+	"time"
+)
+
+// TestEscalateRepeatWindow checks that repeats are escalated within the
+// window and counted afresh once it has passed, on the Now clock
+func TestEscalateRepeatWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func(old func() time.Time) { Now = old }(Now)
+	Now = func() time.Time { return now }
+
+	var got []string
+	h := EscalateRepeatHandler(3, time.Minute, LvlWarn, LvlError, log15.FuncHandler(func(r *log15.Record) error {
+		got = append(got, lvlName(Lvl(r.Lvl)))
+		return nil
+	}))
+
+	warn := func() {
+		h.Log(&log15.Record{Lvl: log15.LvlWarn, Msg: "retrying"})
+	}
+
+	for i := 0; i < 4; i++ {
+		warn()
+		now = now.Add(10 * time.Second)
+	}
+	now = now.Add(time.Minute)
+	warn()
+
+	want := []string{"warn", "warn", "error", "error", "warn"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+// ProjectFieldsHandler returns a handler that keeps only those ctx
+// fields whose keys are in @keys (when @allow is true) or not in @keys
+// (when @allow is false) before passing records on to @h. The time,
+// level and message of a record are always kept. The record handed to
+// @h is a copy, so sibling handlers still see all the fields.
+func ProjectFieldsHandler(keys []string, allow bool, h Handler) Handler {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		rc := *r
+		rc.Ctx = make([]interface{}, 0, len(r.Ctx))
+
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			k, _ := r.Ctx[i].(string)
+			if set[k] == allow {
+				rc.Ctx = append(rc.Ctx, r.Ctx[i], r.Ctx[i+1])
+			}
+		}
+
+		return h.Log(&rc)
+	})
+}
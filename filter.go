@@ -0,0 +1,123 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+// the args of the match_all and match_any handlers, for errors
+const matchArgs = "fields map[string]interface{} | key string, value string|int|float, ..., handler HandlerConf"
+
+// fieldMatches tells if the @key field of @r equals @value, exactly as
+// log15's MatchFilterHandler does: the record's level, time and message
+// are matched by their key names, other keys by the first ctx pair with
+// that key, and values are compared with == so 1 doesn't match 1.0 nor
+// "1". A missing key never matches.
+func fieldMatches(r *log15.Record, key string, value interface{}) bool {
+	switch key {
+	case r.KeyNames.Lvl:
+		return r.Lvl == value
+	case r.KeyNames.Time:
+		return r.Time == value
+	case r.KeyNames.Msg:
+		return r.Msg == value
+	}
+
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		if r.Ctx[i] == key {
+			return r.Ctx[i+1] == value
+		}
+	}
+	return false
+}
+
+// NotMatchFilterHandler is the complement of log15's MatchFilterHandler:
+// it writes to @h the records whose @key field does not equal @value,
+// including those that don't have the field at all, eg: to leave out
+// health checks
+//	NotMatchFilterHandler("component", "healthcheck", h)
+func NotMatchFilterHandler(key string, value interface{}, h Handler) Handler {
+	return log15.FilterHandler(func(r *log15.Record) bool {
+		return !fieldMatches(r, key, value)
+	}, h)
+}
+
+// MatchAllHandler writes to @h the records whose fields match all of
+// @fields, as per match_filter, eg: service=crawler and env=prod
+func MatchAllHandler(fields map[string]interface{}, h Handler) Handler {
+	return log15.FilterHandler(func(r *log15.Record) bool {
+		for k, v := range fields {
+			if !fieldMatches(r, k, v) {
+				return false
+			}
+		}
+		return true
+	}, h)
+}
+
+// MatchAnyHandler writes to @h the records whose fields match at least
+// one of @fields, as per match_filter
+func MatchAnyHandler(fields map[string]interface{}, h Handler) Handler {
+	return log15.FilterHandler(func(r *log15.Record) bool {
+		for k, v := range fields {
+			if fieldMatches(r, k, v) {
+				return true
+			}
+		}
+		return false
+	}, h)
+}
+
+// matchFields reads the fields to match of the match_all and match_any
+// handlers @what from @args, either a single map or key, value pairs
+func matchFields(what string, args []interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+
+	if len(args) == 1 {
+		switch m := args[0].(type) {
+		case map[string]interface{}:
+			for k, v := range m {
+				v, err := matchValue(what, 0, v)
+				if err != nil {
+					return nil, err
+				}
+				fields[k] = v
+			}
+		case map[string]string:
+			for k, v := range m {
+				fields[k] = v
+			}
+		case map[string]int:
+			for k, v := range m {
+				fields[k] = v
+			}
+		case map[string]float64:
+			for k, v := range m {
+				fields[k] = v
+			}
+		default:
+			return nil, badArg(what, 0, "map[string]interface{}", args[0])
+		}
+	} else {
+		if len(args)%2 != 0 {
+			return nil, badArgs(what, matchArgs)
+		}
+
+		for i := 0; i < len(args); i += 2 {
+			k, ok := args[i].(string)
+			if !ok {
+				return nil, badArg(what, i, "string", args[i])
+			}
+			v, err := matchValue(what, i+1, args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			fields[k] = v
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: %s: expected at least one field", BadConf, what)
+	}
+	return fields, nil
+}
@@ -0,0 +1,44 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"testing"
+)
+
+// TestNotMatchFilter checks that not_match_filter drops only the records
+// whose field equals the value, forwarding those missing the field
+func TestNotMatchFilter(t *testing.T) {
+	var got []string
+	sink := log15.FuncHandler(func(r *log15.Record) error {
+		got = append(got, r.Msg)
+		return nil
+	})
+
+	for _, c := range []struct {
+		key   string
+		value interface{}
+		ctx   []interface{}
+		pass  bool
+	}{
+		{"component", "healthcheck", []interface{}{"component", "healthcheck"}, false},
+		{"component", "healthcheck", []interface{}{"component", "api"}, true},
+		{"component", "healthcheck", []interface{}{"status", 200}, true},
+		{"component", "healthcheck", nil, true},
+		{"component", "healthcheck", []interface{}{"component"}, true},
+		{"status", 200, []interface{}{"status", 200}, false},
+		{"status", 200, []interface{}{"status", 200.0}, true},
+		{"status", 200, []interface{}{"status", "200"}, true},
+		{"msg", "hello", nil, false},
+	} {
+		h := NotMatchFilterHandler(c.key, c.value, sink)
+
+		got = nil
+		h.Log(&log15.Record{Msg: "hello", Ctx: c.ctx, KeyNames: log15.RecordKeyNames{
+			Time: "t", Lvl: "lvl", Msg: "msg",
+		}})
+
+		if pass := len(got) == 1; pass != c.pass {
+			t.Errorf("%s=%v with ctx %v: expected forwarded %v, got %v", c.key, c.value, c.ctx, c.pass, pass)
+		}
+	}
+}
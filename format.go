@@ -0,0 +1,422 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	logfmtTimeFormat = "2006-01-02T15:04:05-0700"
+	termTimeFormat   = "01-02|15:04:05"
+	termMsgJust      = 40
+)
+
+// DefaultTerminalColors is the level to ANSI color code mapping used by
+// the "terminal" format unless overridden. It matches log15's palette.
+var DefaultTerminalColors = map[string]string{
+	"crit":  "35",
+	"error": "31",
+	"warn":  "33",
+	"info":  "32",
+	"debug": "36",
+}
+
+var ansiColorRe = regexp.MustCompile(`^[0-9]{1,3}(;[0-9]{1,3})*$`)
+
+// MakeTerminalColors builds the per level color table for
+// TerminalColorFormat. @colors maps a level name (as accepted by
+// level_filter) to an ANSI SGR code such as "95" or "1;35". An empty
+// code disables color for that level. Levels that are not mentioned
+// keep their default color.
+func MakeTerminalColors(colors map[string]string) (map[Lvl]string, error) {
+	res := make(map[Lvl]string)
+	for name, code := range DefaultTerminalColors {
+		lvl, _ := log15.LvlFromString(name)
+		res[Lvl(lvl)] = code
+	}
+
+	for name, code := range colors {
+		lvl, err := log15.LvlFromString(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown level %q", BadConf, name)
+		}
+
+		if code != "" && !ansiColorRe.MatchString(code) {
+			return nil, fmt.Errorf("%w: color of %s: expected an ANSI color code, got %q", BadConf, name, code)
+		}
+
+		res[Lvl(lvl)] = code
+	}
+
+	return res, nil
+}
+
+// TerminalColorFormat is log15's terminal format with a custom
+// level to color mapping (see MakeTerminalColors).
+func TerminalColorFormat(colors map[Lvl]string) Format {
+	return TerminalLayoutFormat(colors, termTimeFormat)
+}
+
+// TerminalLayoutFormat is TerminalColorFormat with the time rendered as
+// per @layout, a Go time layout or one of EpochLayout and EpochMsLayout
+func TerminalLayoutFormat(colors map[Lvl]string, layout string) Format {
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		color := colors[Lvl(r.Lvl)]
+		t := formatTime(r.Time, layout)
+
+		b := &bytes.Buffer{}
+		lvl := strings.ToUpper(r.Lvl.String())
+		if color != "" {
+			fmt.Fprintf(b, "\x1b[%sm%s\x1b[0m[%v] %s ", color, lvl, t, r.Msg)
+		} else {
+			fmt.Fprintf(b, "[%s] [%v] %s ", lvl, t, r.Msg)
+		}
+
+		// try to justify the log output for short messages
+		if len(r.Ctx) > 0 && len(r.Msg) < termMsgJust {
+			b.Write(bytes.Repeat([]byte{' '}, termMsgJust-len(r.Msg)))
+		}
+
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if i != 0 {
+				b.WriteByte(' ')
+			}
+
+			k := fmt.Sprint(r.Ctx[i])
+			v := formatLogfmtValue(r.Ctx[i+1])
+			if color != "" {
+				fmt.Fprintf(b, "\x1b[%sm%s\x1b[0m=%s", color, k, v)
+			} else {
+				fmt.Fprintf(b, "%s=%s", k, v)
+			}
+		}
+
+		b.WriteByte('\n')
+		return b.Bytes()
+	})
+}
+
+// JSONOptions tweak the output of the json formats. They are given
+// after the format name, eg: HandlerConf{"json", JSONOptions{IntsAsStrings: true}}
+type JSONOptions struct {
+	// IntsAsStrings renders integer ctx values as JSON strings so that
+	// 64 bit ids survive consumers that parse JSON numbers as float64
+	IntsAsStrings bool
+
+	// MaxDepth bounds the nesting of ctx values, replacing anything
+	// deeper with TruncatedMarker (see MaxDepthHandler). 0 is unlimited
+	MaxDepth int
+
+	// TimeLayout renders the record time as per a Go time layout or
+	// one of EpochLayout and EpochMsLayout. "" keeps log15's RFC3339
+	TimeLayout string
+}
+
+// JSONFormat is log15's json format (pretty printed if @pretty)
+// adjusted as per @opts
+func JSONFormat(pretty bool, opts JSONOptions) Format {
+	f := log15.JsonFormatEx(pretty, true)
+	if !opts.IntsAsStrings && opts.MaxDepth <= 0 && opts.TimeLayout == "" {
+		return f
+	}
+
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		if opts.MaxDepth > 0 {
+			r = truncateCtx(r, opts.MaxDepth)
+		}
+		if !opts.IntsAsStrings && opts.TimeLayout == "" {
+			return f.Format(r)
+		}
+
+		rc := *r
+		rc.Ctx = make([]interface{}, len(r.Ctx), len(r.Ctx)+2)
+		copy(rc.Ctx, r.Ctx)
+
+		if opts.IntsAsStrings {
+			for i := 1; i < len(rc.Ctx); i += 2 {
+				rc.Ctx[i] = intToString(rc.Ctx[i])
+			}
+		}
+
+		// ctx fields are set after the time in the json object,
+		// so this replaces the time log15 renders
+		if opts.TimeLayout != "" {
+			rc.Ctx = append(rc.Ctx, r.KeyNames.Time, formatTime(r.Time, opts.TimeLayout))
+		}
+
+		return f.Format(&rc)
+	})
+}
+
+// intToString renders @v in decimal if it is of an integer kind.
+// Stringers (eg: time.Duration) are left to render themselves.
+func intToString(v interface{}) interface{} {
+	if _, ok := v.(fmt.Stringer); ok {
+		return v
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10)
+	}
+	return v
+}
+
+// DefaultDualFormatSeparator is written between the two renderings
+// of a record by the "dual_format" handler
+const DefaultDualFormatSeparator = "--\n"
+
+// DualFormat renders each record with @first and then with @second,
+// joined by @separator, so that both appear together on the stream
+func DualFormat(first, second Format, separator string) Format {
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		b := append([]byte{}, first.Format(r)...)
+		b = append(b, separator...)
+		return append(b, second.Format(r)...)
+	})
+}
+
+// KeyNamesFormat renders records with @f after renaming the time, level
+// and message keys as per @keys, for formats that honour a record's key
+// names (json and logfmt). Empty names keep their default. Keys of the
+// ctx fields are not affected.
+func KeyNamesFormat(keys RecordKeyNames, f Format) Format {
+	if keys == (RecordKeyNames{}) {
+		return f
+	}
+
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		rc := *r
+		if keys.Time != "" {
+			rc.KeyNames.Time = keys.Time
+		}
+		if keys.Lvl != "" {
+			rc.KeyNames.Lvl = keys.Lvl
+		}
+		if keys.Msg != "" {
+			rc.KeyNames.Msg = keys.Msg
+		}
+		return f.Format(&rc)
+	})
+}
+
+// Time layouts for unix timestamps, accepted wherever the formats
+// take a Go time layout
+const (
+	EpochLayout   = "epoch"    // seconds
+	EpochMsLayout = "epoch_ms" // milliseconds
+)
+
+// formatTime renders @t as per @layout, a Go time layout or one of
+// EpochLayout and EpochMsLayout
+func formatTime(t time.Time, layout string) interface{} {
+	switch layout {
+	case EpochLayout:
+		return t.Unix()
+	case EpochMsLayout:
+		return t.UnixNano() / int64(time.Millisecond)
+	}
+	return t.Format(layout)
+}
+
+// LogfmtLayoutFormat is log15's logfmt format with the time rendered as
+// per @layout, a Go time layout or one of EpochLayout and EpochMsLayout
+func LogfmtLayoutFormat(layout string) Format {
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		ctx := append([]interface{}{
+			r.KeyNames.Time, formatTime(r.Time, layout),
+			r.KeyNames.Lvl, r.Lvl,
+			r.KeyNames.Msg, r.Msg,
+		}, r.Ctx...)
+
+		b := &bytes.Buffer{}
+		for i := 0; i+1 < len(ctx); i += 2 {
+			if i != 0 {
+				b.WriteByte(' ')
+			}
+
+			b.WriteString(fmt.Sprint(ctx[i]))
+			b.WriteByte('=')
+			b.WriteString(formatLogfmtValue(ctx[i+1]))
+		}
+
+		b.WriteByte('\n')
+		return b.Bytes()
+	})
+}
+
+// formatLogfmtValue renders a ctx value the way log15's logfmt does
+func formatLogfmtValue(value interface{}) string {
+	if value == nil {
+		return "nil"
+	}
+
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+		return "nil"
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(logfmtTimeFormat)
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', 3, 64)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 3, 64)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", value)
+	case string:
+		return escapeLogfmtString(v)
+	default:
+		return escapeLogfmtString(fmt.Sprintf("%+v", value))
+	}
+}
+
+func escapeLogfmtString(s string) string {
+	if strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\'
+	}) < 0 {
+		return s
+	}
+
+	return strconv.Quote(s)
+}
+
+// OTelSeverity maps log15 levels to OpenTelemetry severity numbers and
+// texts for the "otel_json" format. Each level takes the lowest number
+// of its OTel range:
+//	debug	5	DEBUG
+//	info	9	INFO
+//	warn	13	WARN
+//	error	17	ERROR
+//	crit	21	FATAL
+var OTelSeverity = map[Lvl]struct {
+	Number int
+	Text   string
+}{
+	LvlDebug: {5, "DEBUG"},
+	LvlInfo:  {9, "INFO"},
+	LvlWarn:  {13, "WARN"},
+	LvlError: {17, "ERROR"},
+	LvlCrit:  {21, "FATAL"},
+}
+
+// OTelJSONFormat renders each record as one line of the OpenTelemetry
+// Collector's file exporter JSON (an OTLP ExportLogsServiceRequest), so
+// that the collector can tail the file directly. @resource holds the
+// resource attributes, eg: {"service.name": "crawler"}. The ctx fields
+// become the log record attributes.
+func OTelJSONFormat(resource map[string]string) Format {
+	var resAttrs []otelKeyValue
+	for k, v := range resource {
+		resAttrs = append(resAttrs, otelKeyValue{k, otelValue(v)})
+	}
+	sort.Slice(resAttrs, func(i, j int) bool { return resAttrs[i].Key < resAttrs[j].Key })
+
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		sev := OTelSeverity[Lvl(r.Lvl)]
+		ts := strconv.FormatInt(r.Time.UnixNano(), 10)
+
+		rec := otelLogRecord{
+			TimeUnixNano:         ts,
+			ObservedTimeUnixNano: ts,
+			SeverityNumber:       sev.Number,
+			SeverityText:         sev.Text,
+			Body:                 otelValue(r.Msg),
+		}
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			rec.Attributes = append(rec.Attributes, otelKeyValue{fmt.Sprint(r.Ctx[i]), otelValue(r.Ctx[i+1])})
+		}
+
+		req := otelRequest{ResourceLogs: []otelResourceLogs{{
+			Resource:  otelResource{resAttrs},
+			ScopeLogs: []otelScopeLogs{{LogRecords: []otelLogRecord{rec}}},
+		}}}
+
+		b, err := json.Marshal(req)
+		if err != nil {
+			b, _ = json.Marshal(map[string]string{"LOG_ERROR": err.Error()})
+		}
+		return append(b, '\n')
+	})
+}
+
+// the subset of OTLP's JSON encoding produced by OTelJSONFormat
+
+type otelRequest struct {
+	ResourceLogs []otelResourceLogs `json:"resourceLogs"`
+}
+
+type otelResourceLogs struct {
+	Resource  otelResource    `json:"resource"`
+	ScopeLogs []otelScopeLogs `json:"scopeLogs"`
+}
+
+type otelResource struct {
+	Attributes []otelKeyValue `json:"attributes,omitempty"`
+}
+
+type otelScopeLogs struct {
+	Scope      struct{}        `json:"scope"`
+	LogRecords []otelLogRecord `json:"logRecords"`
+}
+
+type otelLogRecord struct {
+	TimeUnixNano         string                 `json:"timeUnixNano"`
+	ObservedTimeUnixNano string                 `json:"observedTimeUnixNano"`
+	SeverityNumber       int                    `json:"severityNumber"`
+	SeverityText         string                 `json:"severityText"`
+	Body                 map[string]interface{} `json:"body"`
+	Attributes           []otelKeyValue         `json:"attributes,omitempty"`
+}
+
+type otelKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otelValue encodes @v as an OTLP AnyValue. Values other than
+// strings, bools and numbers are sent as their string form.
+func otelValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case float32:
+		return map[string]interface{}{"doubleValue": float64(v)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	case error:
+		return map[string]interface{}{"stringValue": v.Error()}
+	case fmt.Stringer:
+		return map[string]interface{}{"stringValue": v.String()}
+	case nil:
+		return map[string]interface{}{}
+	}
+
+	// 64 bit ints are strings in OTLP JSON
+	if s, ok := intToString(v).(string); ok {
+		return map[string]interface{}{"intValue": s}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprintf("%+v", v)}
+}
@@ -0,0 +1,77 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"os"
+	"regexp"
+)
+
+// GELFLevels maps log15 levels to the syslog severities
+// used as the "level" of GELF messages
+var GELFLevels = map[Lvl]int{
+	LvlCrit:  2,
+	LvlError: 3,
+	LvlWarn:  4,
+	LvlInfo:  6,
+	LvlDebug: 7,
+}
+
+var gelfFieldRe = regexp.MustCompile(`[^\w.\-]`)
+
+// GELFFormat renders each record as a GELF 1.1 JSON message for Graylog.
+// @host is the "host" field; "" means os.Hostname(). Ctx fields become
+// additional fields prefixed with "_" (invalid characters in the key
+// replaced by "_", and "id", reserved by GELF, sent as "__id"). Scalar
+// values are kept as they are; others are sent JSON encoded.
+func GELFFormat(host string) Format {
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		m := map[string]interface{}{
+			"version":       "1.1",
+			"host":          host,
+			"short_message": r.Msg,
+			"timestamp":     float64(r.Time.UnixNano()) / 1e9,
+			"level":         GELFLevels[Lvl(r.Lvl)],
+		}
+
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			k := gelfFieldRe.ReplaceAllString(fmt.Sprint(r.Ctx[i]), "_")
+			if k == "id" {
+				k = "_id"
+			}
+			m["_"+k] = gelfValue(r.Ctx[i+1])
+		}
+
+		b, err := json.Marshal(m)
+		if err != nil {
+			b, _ = json.Marshal(map[string]string{"LOG_ERROR": err.Error()})
+		}
+		return append(b, '\n')
+	})
+}
+
+// gelfValue returns @v if it is a scalar, and its JSON encoding otherwise
+func gelfValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, string, bool,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return string(b)
+}
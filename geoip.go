@@ -0,0 +1,76 @@
+package log
+
+import (
+	"github.com/oschwald/geoip2-golang"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net"
+)
+
+// GeoIPHandler returns a handler that looks up the IP address found in
+// the ctx under @ipKey in the MaxMind database @db and attaches the
+// geo_country (ISO code) and geo_city (English name) fields before
+// passing the record on to @h. Values may carry a port ("ip:port").
+// Records with a missing or invalid IP, or one that isn't in the
+// database, are passed on unchanged.
+func GeoIPHandler(db *geoip2.Reader, ipKey string, h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if r.Ctx[i] != ipKey {
+				continue
+			}
+
+			ip := parseIP(r.Ctx[i+1])
+			if ip == nil {
+				break
+			}
+
+			city, err := db.City(ip)
+			if err != nil {
+				break
+			}
+
+			if city.Country.IsoCode != "" {
+				r.Ctx = append(r.Ctx, "geo_country", city.Country.IsoCode)
+			}
+			if name := city.City.Names["en"]; name != "" {
+				r.Ctx = append(r.Ctx, "geo_city", name)
+			}
+			break
+		}
+
+		return h.Log(r)
+	})
+}
+
+func parseIP(v interface{}) net.IP {
+	switch v := v.(type) {
+	case net.IP:
+		return v
+	case string:
+		if host, _, err := net.SplitHostPort(v); err == nil {
+			v = host
+		}
+		return net.ParseIP(v)
+	}
+
+	return nil
+}
+
+// geoDBCloser closes the geoip database when the package is closed
+type geoDBCloser struct {
+	db *geoip2.Reader
+}
+
+func (p geoDBCloser) Close() error {
+	return p.db.Close()
+}
+
+// openGeoIPDB memory maps the MaxMind database at @path
+func openGeoIPDB(path string) (*geoip2.Reader, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,92 @@
+package log
+
+import (
+	"bytes"
+	"gopkg.in/inconshreveable/log15.v2"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// goroutine local ctx, keyed by goroutine id
+var goCtxs struct {
+	sync.RWMutex
+	m map[uint64]Ctx
+}
+
+// goid returns the id of the calling goroutine
+func goid() uint64 {
+	b := make([]byte, 64)
+	b = b[:runtime.Stack(b, false)]
+
+	// "goroutine 123 [running]: ..."
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// SetGoroutineCtx attaches @ctx to the calling goroutine. Records logged
+// from this goroutine through a "goroutine_ctx" handler carry it. Call
+// ClearGoroutineCtx before the goroutine ends to not leak it.
+func SetGoroutineCtx(ctx Ctx) {
+	goCtxs.Lock()
+	defer goCtxs.Unlock()
+
+	if goCtxs.m == nil {
+		goCtxs.m = make(map[uint64]Ctx)
+	}
+	goCtxs.m[goid()] = ctx
+}
+
+// GoroutineCtx returns the ctx attached to the calling goroutine
+func GoroutineCtx() Ctx {
+	goCtxs.RLock()
+	defer goCtxs.RUnlock()
+
+	return goCtxs.m[goid()]
+}
+
+// ClearGoroutineCtx detaches any ctx from the calling goroutine
+func ClearGoroutineCtx() {
+	goCtxs.Lock()
+	defer goCtxs.Unlock()
+
+	delete(goCtxs.m, goid())
+}
+
+// GoWithContext runs @fn in a new goroutine with the calling
+// goroutine's ctx (see SetGoroutineCtx), plus @ctx, attached to it, and
+// detaches it once @fn returns. The ctx is captured when GoWithContext is
+// called; later changes in either goroutine don't affect the other.
+func GoWithContext(ctx Ctx, fn func()) {
+	merged := Ctx{}
+	for k, v := range GoroutineCtx() {
+		merged[k] = v
+	}
+	for k, v := range ctx {
+		merged[k] = v
+	}
+
+	go func() {
+		SetGoroutineCtx(merged)
+		defer ClearGoroutineCtx()
+
+		fn()
+	}()
+}
+
+// GoroutineCtxHandler returns a handler that adds the ctx attached to
+// the logging goroutine (see SetGoroutineCtx) to each record. It must
+// run on the logging goroutine, ie: not below a buffered handler.
+func GoroutineCtxHandler(h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		if ctx := GoroutineCtx(); len(ctx) > 0 {
+			r.Ctx = append(r.Ctx, ctx.Pairs()...)
+		}
+		return h.Log(r)
+	})
+}
@@ -1,28 +1,81 @@
 package log
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"github.com/garyburd/redigo/redis"
 	"golang.org/x/crypto/ssh/terminal"
 	"gopkg.in/inconshreveable/log15.v2"
-	"io"
+	"io/ioutil"
 	"log/syslog"
 	"os"
+	"strings"
+	"time"
 )
 
+// BadConf is the error for a configuration that can't be used. It comes
+// wrapped with what is wrong, so check for it with errors.Is, eg:
+//	Bad configuration: handler "buffered" arg 0: expected int, got string
 var BadConf error = errors.New("Bad configuration")
 
+// badArgs returns BadConf annotated with the arguments that @what (eg:
+// `handler "buffered"`) takes, for when it's given the wrong number
+func badArgs(what string, sig string) error {
+	if sig == "" {
+		return fmt.Errorf("%w: %s: expected no args", BadConf, what)
+	}
+	return fmt.Errorf("%w: %s: expected args (%s)", BadConf, what, sig)
+}
+
+// badArg returns BadConf annotated with the type @want that argument @i
+// of @what should have and the type of @v it was given instead
+func badArg(what string, i int, want string, v interface{}) error {
+	return fmt.Errorf("%w: %s arg %d: expected %s, got %T", BadConf, what, i, want, v)
+}
+
+// badValue returns BadConf annotated with what argument @i of @what
+// should be and the value @v it was given instead
+func badValue(what string, i int, want string, v interface{}) error {
+	return fmt.Errorf("%w: %s arg %d: expected %s, got %v", BadConf, what, i, want, v)
+}
+
+// matchValue returns @v, argument @i of @what, if it is a value that can
+// be matched: a string, int or float. Others would never match, or make
+// the comparison panic.
+func matchValue(what string, i int, v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case string, int, float64:
+		return v, nil
+	}
+	return nil, badArg(what, i, "string, int or float", v)
+}
+
 type FormatConf interface{}
 
 // MakeFormatter constructs a object of type Format
 // based on the specified format conf and returns it
 // Currently @format has to be a string with one of
-// json | json_pretty | logfmt | terminal
+// json | json_pretty | json_flat | logfmt | terminal | terminal_color | msgpack |
+// stackdriver
+// or a HandlerConf style sequence [formatName string, args ...interface{}]
+// for formats that take options. eg:
+//	HandlerConf{"terminal", map[string]string{"warn": "95", "info": "2"}}
+// Formats registered with RegisterFormatter are accepted too.
 func MakeFormatter(format FormatConf) (Format, error) {
 
+	if conf, ok := format.(HandlerConf); ok {
+		return makeFormatterFromConf(conf)
+	}
+
 	format_name, ok := format.(string)
 	if !ok {
-		return nil, BadConf
+		return nil, fmt.Errorf("%w: format: expected string or HandlerConf, got %T", BadConf, format)
+	}
+
+	if factory := registeredFormatter(format_name); factory != nil {
+		return factory(nil)
 	}
 
 	switch format_name {
@@ -33,19 +86,278 @@ func MakeFormatter(format FormatConf) (Format, error) {
 	case "json_pretty":
 		return log15.JsonFormatEx(true, true), nil
 
+	case "json_flat":
+		return JSONFlatFormat(0), nil
+
 	case "logfmt":
 		return log15.LogfmtFormat(), nil
 
 	case "terminal":
 		return log15.TerminalFormat(), nil
 
+	case "terminal_color":
+		table, _ := MakeTerminalColors(nil)
+		return TTYColorFormat(table, termTimeFormat), nil
+
+	case "otel_json":
+		return OTelJSONFormat(nil), nil
+
+	case "gelf":
+		return GELFFormat(""), nil
+
+	case "cef":
+		return CEFFormat(), nil
+
+	case "msgpack":
+		return MsgpackFormat(), nil
+
+	case "stackdriver":
+		return StackdriverFormat(), nil
+
+	case "syslog_rfc5424":
+		return RFC5424Format(""), nil
+
+	}
+
+	return nil, fmt.Errorf("%w: unknown format %q", BadConf, format_name)
+}
+
+func makeFormatterFromConf(conf HandlerConf) (Format, error) {
+	if len(conf) < 1 {
+		return nil, fmt.Errorf("%w: format: empty conf", BadConf)
+	}
+
+	name, ok := conf[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: format: expected name string, got %T", BadConf, conf[0])
+	}
+	args := conf[1:]
+	what := fmt.Sprintf("format %q", name)
+
+	if factory := registeredFormatter(name); factory != nil {
+		return factory(args)
+	}
+
+	switch name {
+
+	case "json", "json_pretty":
+		// json ([opts JSONOptions | layout string], [keys RecordKeyNames])
+		//		layout = Go time layout | epoch | epoch_ms
+
+		if len(args) == 0 {
+			return MakeFormatter(name)
+		}
+
+		if len(args) > 2 {
+			return nil, badArgs(what, "[opts JSONOptions | layout string], [keys RecordKeyNames]")
+		}
+
+		keys, ok := args[len(args)-1].(RecordKeyNames)
+		if ok {
+			args = args[:len(args)-1]
+		}
+
+		var opts JSONOptions
+		if len(args) > 1 {
+			return nil, badArgs(what, "[opts JSONOptions | layout string], [keys RecordKeyNames]")
+		} else if len(args) == 1 {
+			switch arg := args[0].(type) {
+			case JSONOptions:
+				opts = arg
+			case string:
+				opts.TimeLayout = arg
+			default:
+				return nil, badArg(what, 0, "JSONOptions or string", arg)
+			}
+		}
+
+		return KeyNamesFormat(keys, JSONFormat(name == "json_pretty", opts)), nil
+
+	case "json_flat":
+		// json_flat ([max_depth int])
+
+		if len(args) == 0 {
+			return MakeFormatter(name)
+		}
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "[max_depth int]")
+		}
+
+		maxDepth, ok := args[0].(int)
+		if !ok {
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if maxDepth < 1 {
+			return nil, badValue(what, 0, "at least 1", maxDepth)
+		}
+
+		return JSONFlatFormat(maxDepth), nil
+
+	case "logfmt":
+		// logfmt ([layout string], [keys RecordKeyNames])
+		//		layout = Go time layout | epoch | epoch_ms
+
+		if len(args) == 0 {
+			return MakeFormatter(name)
+		}
+
+		if len(args) > 2 {
+			return nil, badArgs(what, "[layout string], [keys RecordKeyNames]")
+		}
+
+		keys, ok := args[len(args)-1].(RecordKeyNames)
+		if ok {
+			args = args[:len(args)-1]
+		}
+
+		var f Format = log15.LogfmtFormat()
+		if len(args) > 1 {
+			return nil, badArgs(what, "[layout string], [keys RecordKeyNames]")
+		} else if len(args) == 1 {
+			layout, ok := args[0].(string)
+			if !ok {
+				return nil, badArg(what, 0, "string", args[0])
+			}
+			f = LogfmtLayoutFormat(layout)
+		}
+
+		return KeyNamesFormat(keys, f), nil
+
+	case "csv":
+		// csv (columns []string, [header bool])
+
+		if len(args) != 1 && len(args) != 2 {
+			return nil, badArgs(what, "columns []string, [header bool]")
+		}
+
+		columns, ok := args[0].([]string)
+		if !ok {
+			return nil, badArg(what, 0, "[]string", args[0])
+		}
+		if len(columns) == 0 {
+			return nil, badValue(what, 0, "at least one column", args[0])
+		}
+
+		header := false
+		if len(args) == 2 {
+			header, ok = args[1].(bool)
+			if !ok {
+				return nil, badArg(what, 1, "bool", args[1])
+			}
+		}
+
+		return CSVFormat(columns, header), nil
+
+	case "syslog_rfc5424":
+		// syslog_rfc5424 ([app string])
+
+		if len(args) == 0 {
+			return MakeFormatter(name)
+		}
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "[app string]")
+		}
+
+		app, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		return RFC5424Format(app), nil
+
+	case "gelf":
+		// gelf ([host string])
+
+		if len(args) == 0 {
+			return MakeFormatter(name)
+		}
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "[host string]")
+		}
+
+		host, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		return GELFFormat(host), nil
+
+	case "otel_json":
+		// otel_json ([resource map[string]string])
+
+		if len(args) == 0 {
+			return MakeFormatter(name)
+		}
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "[resource map[string]string]")
+		}
+
+		resource, ok := args[0].(map[string]string)
+		if !ok {
+			return nil, badArg(what, 0, "map[string]string", args[0])
+		}
+
+		return OTelJSONFormat(resource), nil
+
+	case "terminal", "terminal_color":
+		// terminal ([colors map[string]string,] [layout string])
+		// terminal_color ([colors map[string]string,] [layout string])
+		//		colors = level name -> ANSI color code. "" disables color
+		//		layout = Go time layout | epoch | epoch_ms
+
+		if len(args) == 0 {
+			return MakeFormatter(name)
+		}
+
+		if len(args) > 2 {
+			return nil, badArgs(what, "[colors map[string]string,] [layout string]")
+		}
+
+		colors, ok := args[0].(map[string]string)
+		if ok {
+			args = args[1:]
+		}
+
+		layout := termTimeFormat
+		if len(args) > 1 {
+			return nil, badArgs(what, "[colors map[string]string,] [layout string]")
+		} else if len(args) == 1 {
+			layout, ok = args[0].(string)
+			if !ok {
+				return nil, badArg(what, len(conf)-2, "string", args[0])
+			}
+		}
+
+		table, err := MakeTerminalColors(colors)
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "terminal_color" {
+			return TTYColorFormat(table, layout), nil
+		}
+		return TerminalLayoutFormat(table, layout), nil
+
 	}
 
-	return nil, BadConf
+	// formats without options may also be specified as a sequence
+	if len(args) == 0 {
+		return MakeFormatter(name)
+	}
+
+	return nil, badArgs(what, "")
 }
 
 type HandlerConf []interface{}
 
+// the args of the redis handlers, for errors
+const redisArgs = "ip_port string, channel string, [mode string, [max_len int]], " +
+	"[alive_key string, alive_ttl int], [opts RedisOptions]"
+
 // MakeHandler accepts a handler configuration and constructs a usable
 //  handler. The handler config can be used to create sophistacted behavior
 //  by composing handlers as described here
@@ -67,65 +379,421 @@ type HandlerConf []interface{}
 //		that only log statements that are greater than or equal to the
 //		specified level "debug".
 //
+//	NOTE: handlers registered with RegisterHandler are built by their
+//	factory from the arguments following their name, before the built-in
+//	handlers below are considered. set SafeRegisteredHandlers to have them
+//	all wrapped like the "safe" handler.
+//
+//	NOTE: a handler that holds files, connections or buffers can be closed
+//	(it is an io.Closer), and closing a handler closes the handlers it
+//	wraps. when building fails part way, the handlers already built are
+//	closed.
+//
+//	NOTE: when LoopDetection is set, the "http", "kafka", "logstash", "net",
+//	"net_reconnect" and "redis" handlers stamp records with this process's
+//	OriginID and drop records that already carry it, breaking log-to-self
+//	feedback loops.
+//
 //	NOTE: for additional information about the following please
 //	refer to the godoc link placed above.
 //
 //	List of handler formats:
 //		json
 //      json_pretty
+//		json_flat
+//			json with nested ctx objects and arrays flattened into dotted
+//			keys, eg: "user.id", "tags.0", down to JSONFlatDepth levels
+//		cef
+//			ArcSight Common Event Format. see CEFFormat and CEFSeverities
+//		gelf
+//			GELF 1.1 JSON for Graylog. "host" is os.Hostname(), ctx fields are
+//			sent as "_" prefixed additional fields. see GELFLevels
 //		logfmt
+//		msgpack
+//			binary MessagePack maps of t, lvl, msg and the ctx fields, for
+//			the kafka and redis handlers or files read by programs. not
+//			for "stream" or a terminal. see MsgpackFormat
+//		otel_json
+//			the OpenTelemetry Collector's file exporter JSON, one record per
+//			line. see OTelSeverity for how levels map to severities
+//		stackdriver
+//			Google Cloud Logging structured JSON: severity, message, timestamp
+//			and the ctx fields, with the caller_file and caller_func fields
+//			as the sourceLocation. see StackdriverSeverity
+//		syslog_rfc5424
+//			RFC5424 syslog with the ctx fields as STRUCTURED-DATA, eg:
+//			<14>1 2024-01-02T15:04:05.000000+05:30 host app 42 - [ctx@32473 k="v"] msg
 //		terminal
+//		HandlerConf{"json" | "json_pretty", opts JSONOptions}
+//			eg: JSONOptions{IntsAsStrings: true} to keep 64 bit ids exact
+//		HandlerConf{"json" | "json_pretty" | "logfmt", layout string}
+//			renders the time ("t") as per `layout`, a Go time layout such as
+//			"2006-01-02 15:04:05", or "epoch" / "epoch_ms" for unix seconds /
+//			milliseconds. eg: HandlerConf{"json", "2006-01-02T15:04:05.000Z07:00"}
+//		HandlerConf{"json" | "json_pretty" | "logfmt", [opts | layout,] keys RecordKeyNames}
+//			renames the time, level and message keys (t, lvl and msg), eg:
+//			RecordKeyNames{Time: "@timestamp", Lvl: "level", Msg: "message"}
+//			names left empty keep their default. ctx keys are not affected.
+//		HandlerConf{"csv", columns []string, [header bool]}
+//			one CSV row per record. "t", "lvl" and "msg" are the record's
+//			time, level and message, other columns are ctx fields. `header`
+//			writes the column names before the first row (off by default)
+//			eg: HandlerConf{"csv", []string{"t", "lvl", "msg", "url"}}
+//		HandlerConf{"json_flat", max_depth int}
+//			values nested deeper than `max_depth` are kept JSON encoded
+//		HandlerConf{"gelf", host string}
+//		HandlerConf{"syslog_rfc5424", app string}
+//		HandlerConf{"otel_json", resource map[string]string}
+//			resource attributes eg: {"service.name": "crawler"}
+//		HandlerConf{"terminal", [colors map[string]string,] [layout string]}
+//			colors = level name -> ANSI color code eg: {"warn": "95"}
+//			an empty code disables color for that level
+//			layout = time layout as for json above
+//		HandlerConf{"terminal_color", [colors map[string]string,] [layout string]}
+//			like terminal, but colored only when the "stream" handler
+//			writes to a terminal (see NoColorEnv and ForceColorEnv), eg:
+//			HandlerConf{"stream", "stderr", HandlerConf{"terminal_color",
+//				map[string]string{"error": "31", "info": "36"}}}
 //
 //	List of handlers:
 //
+//	- async (bufSize int, overflow string, handler HandlerConf)
+//		overflow = block | drop_new | drop_old
+//		forwards records from a goroutine through a buffer of `bufSize`.
+//		when it's full `block` waits like buffered does, while `drop_new`
+//		and `drop_old` drop the incoming or the oldest record without
+//		blocking and count it (see AsyncHandler.Dropped)
 //	- buffered (bufSize int, handler HandlerConf)
 //	- caller_file (handler HandlerConf)
 //	- caller_func (handler HandlerConf)
+//	- caller_pkg (handler HandlerConf)
 //	- caller_stack (format string, handler HandlerConf)
+//	- caller_stack_structured (depth int, handler HandlerConf)
+//		adds "stack" as a list of {file, line, func}, at most `depth` long
+//	- cloudwatch (group string, stream string, region string, [format string])
+//		sends records formatted as per `format` (json by default) to the
+//		AWS CloudWatch Logs `stream` of `group`, creating them if needed.
+//		`region` "" is AWS_REGION. credentials come from the environment,
+//		see CloudWatchHandler. batches keep to the PutLogEvents limits and
+//		throttled calls are retried rather than dropped.
+//	- dedup (window string, handler HandlerConf)
+//		suppresses a record identical to the previous one (level, msg and
+//		ctx) arriving within `window` (a duration such as "10s"), and once
+//		the repeats end, or the handler is flushed or closed, logs the last
+//		of them with repeated=N
+//	- delayed_sample (warmup_ms int, rate float64, handler HandlerConf)
+//		keeps every record for `warmup_ms` after process start and from then
+//		on keeps a record with probability `rate` [0, 1]
+//	- dict_compress (keys []string, resync_ms int, handler HandlerConf)
+//		experimental. replaces a repeated set of the ctx fields `keys` with
+//		dict_ref=N, sending the full set with dict_id=N the first time and
+//		again every `resync_ms`. see DictCompressHandler for the protocol
 //	- discard ()
+//	- dual_format (human_format string, json_format string, stream string,
+//			[json_first bool, separator string])
+//		writes every record twice to the same stream, once in each format,
+//		with `separator` (default "--\n") in between. the human readable
+//		line comes first unless `json_first` is true.
+//	- error_caller (handler HandlerConf)
+//		adds "file" and "line" of the calling code to error and crit records
+//		only, sparing the caller lookup for the other levels
+//	- error_stack (handler HandlerConf)
+//		adds the stack trace carried by an error in the ctx (eg: one made
+//		by github.com/pkg/errors) as error_stack, an array of frames in
+//		the json formats
+//	- escalate_repeat (threshold int, window_ms int, [from string, to string,]
+//			handler HandlerConf)
+//		relabels a `from` (default warn) record as `to` (default error) once
+//		its message repeats `threshold` times within `window_ms`, adding
+//		escalated=true
 //	- failover (handler ...HandlerConf)
 //  - file (path string, format string)
+//		appends to the file at `path`. ReopenFiles reopens it there, eg:
+//		after logrotate moved it (see HandleSIGHUP)
+//	- file_sync (path string, format string, sync_every int)
+//		file that calls fsync after every `sync_every` records so that
+//		they survive a power loss. syncing each record waits on the disk
+//		(eg: ~74µs a record instead of ~5µs for "file" on an SSD), a
+//		larger `sync_every` risks losing up to `sync_every`-1 records for
+//		speed (~18µs at 10, ~8µs at 100; see BenchmarkFileSync). see
+//		"buffered" for the opposite trade off
+//		eg: HandlerConf{"file_sync", "/var/log/audit.log", "json", 1}
+//	- geoip (db_path string, ip_key string, handler HandlerConf)
+//		adds geo_country and geo_city for the IP in ctx key `ip_key`
+//		(eg: "remote_addr") using the MaxMind database at `db_path`
+//	- goroutine_ctx (handler HandlerConf)
+//		adds the ctx attached to the logging goroutine by SetGoroutineCtx
+//		or GoWithContext
+//	- http (url string, format string)
+//		POSTs records to `url` (eg: a webhook) with a Content-Type matching
+//		`format`. records are sent in batches every HTTPFlushInterval, as a
+//		JSON array for the json formats (see HTTPMaxBatch to send them one
+//		by one), and requests that fail or are answered with a 5xx are
+//		retried with backoff. wrap it in a level_filter for eg: error only
+//		alerts.
+//	- kafka (brokers string, topic string, format string, [route string])
+//		`brokers` is a comma separated list of "host:port". records are
+//		produced in the background from a buffer of KafkaBufferSize records;
+//		when it is full the oldest record is dropped (see
+//		(*KafkaHandler).Dropped)
+//		`route` = topic | level. topic (the default) produces everything to
+//			`topic`. level produces each record to `topic` + the name of its
+//			level, eg: "logs." sends errors to "logs.error", batching per
+//			topic
 //  - lazy (handler HandlerConf)
-//  - level_filter (level string, handler HandlerConf)
+//  - level_filter (level string|int, handler HandlerConf)
 //		level = debug | info | warn | error | crit
+//		or a number from 0 (crit) to 4 (debug), see LvlFromAny
+//	- level_from_field (key string, handler HandlerConf)
+//		sets the record's level from its `key` ctx field (eg: "severity")
+//		when that holds a level name. other records are left as they are.
+//	- level_route (min_level string, handler HandlerConf, ...)
+//		sends each record to every handler whose `min_level` it is at or
+//		above. eg: "debug", fileConf, "warn", webhookConf sends everything
+//		to the file and warn, error and crit records to the webhook too
+//	- level_router (routes map[string]HandlerConf)
+//		sends each record to the handler for its level. levels without a
+//		route are dropped. eg: map[string]HandlerConf{
+//			"crit": critConf, "error": critConf, "warn": fileConf}
+//	- level_sample (rates map[string]float64, handler HandlerConf)
+//		`rates` maps a level name to the probability [0, 1] of keeping a
+//			record of that level. unlisted levels are always kept.
+//		eg: map[string]float64{"warn": 0.5, "info": 0.01, "debug": 0.01}
+//	- logstash (address string, [format string])
+//		sends records to a Logstash tcp input with the json_lines codec,
+//		one per line, in `format` (json by default). reconnects with
+//		backoff when the connection is lost, buffering the latest
+//		LogstashBufferSize records meanwhile. unlike "net", each record is
+//		newline terminated whatever the format.
 //  - match_filter (key string, value string|int|float, handler HandlerConf)
-//	- multi (handler ...HandlerConf)
+//	- match_all (fields map[string]interface{} | key string, value string|int|float, ...,
+//			handler HandlerConf)
+//	- match_any (fields map[string]interface{} | key string, value string|int|float, ...,
+//			handler HandlerConf)
+//		passes on records where all (match_all) or at least one (match_any)
+//		of the fields match, given as a map or as key, value pairs, eg:
+//		HandlerConf{"match_all", "service", "crawler", "env", "prod", HandlerConf{...}}
+//		values are compared like match_filter does, with == on the
+//		value as given: the int 1 matches neither 1.0 nor "1". in JSON
+//		and YAML confs whole numbers are ints as pairs but float64s in a
+//		map, so give integer fields as pairs.
+//	- not_match_filter (key string, value string|int|float, handler HandlerConf)
+//		the opposite of match_filter: passes on records whose `key` field
+//		isn't `value`, or that have no `key` field at all
+//	- max_depth (depth int, handler HandlerConf)
+//		replaces ctx values nested more than `depth` levels deep with
+//		"<truncated>". 0 is unlimited. the json formats take the same limit
+//		as JSONOptions{MaxDepth: depth}
+//	- metrics (handler HandlerConf)
+//		counts records by level in the Prometheus counter
+//		log_records_total{level="..."}. register MetricsCollector() to
+//		export it
+//	- monotonic (handler HandlerConf)
+//		adds "mono_ns", a strictly increasing monotonic clock reading that
+//		orders records within one process lifetime
+//	- multi ([priority int,] handler HandlerConf, ...)
+//		each child may be preceded by an int priority which decides the
+//		order in which children are closed by (*MultiHandler).Close, lower
+//		first. unannotated children have priority 0 and children of equal
+//		priority close in the order they are listed.
 //	- net (network string, address string, format string)
+//	- net_reconnect (network string, address string, format string)
+//		like net, but redials with exponential backoff (NetRetryBackoff up
+//		to NetMaxBackoff) when a write fails or the remote closes the
+//		connection, buffering the latest NetReconnectBufferSize records
+//		meanwhile. it doesn't fail when the remote is down at start. see
+//		NetReconnectHandler for the reconnect and dropped record counts
+//	- project_fields (allow []string, handler HandlerConf)
+//		passes on only the ctx fields listed in `allow`
+//	- drop_fields (deny []string, handler HandlerConf)
+//		passes on all ctx fields except those listed in `deny`
+//		(time, level and message are always passed on by both)
+//	- rate_limit (per_second int, handler HandlerConf)
+//		forwards at most `per_second` records a second, dropping the rest,
+//		and reports how many were dropped when the throttling ends
+//	- redact (keys []string, replacement string, handler HandlerConf)
+//		replaces the values of the ctx fields named in `keys`, in any case,
+//		with `replacement`, also in maps logged as values, eg:
+//		HandlerConf{"redact", []string{"password", "ssn"}, "***", HandlerConf{...}}
+//	- redact_patterns (patterns []string, [mask string,] handler HandlerConf)
+//		`patterns` are regexes or built-in names:
+//			email | credit_card | ssn | bearer_token
+//		credit_card matches only count if they pass the Luhn check.
+//		`mask` replaces each match. when omitted or "", matches are replaced
+//			by '*' preserving their length.
+//		applies to the message and to ctx values that are strings, errors
+//			or fmt.Stringers.
+//		also accepted as redact_pattern.
+//	- request_buffer (keep_errors bool, handler HandlerConf)
+//		buffers records by their "req_id" until Commit or Discard is called
+//		on the returned *RequestBufferHandler. `keep_errors` makes Discard
+//		write out requests that logged an error. requests never committed
+//		nor discarded are written out past RequestBufferMaxRequests of
+//		them or RequestBufferMaxAge, and on Close.
+//	- ring (size int, [format string,] handler HandlerConf)
+//		also keeps the last `size` records formatted as per `format` (json
+//		by default) for the returned *RingHandler's Snapshot, or to serve
+//		them as an http.Handler, eg: at /debug/logs
+//	- rotating_file (path string, format string, max_bytes int, max_backups int,
+//			[compress bool, [max_age string]])
+//		rolls the file over to path.1, path.2 ... when it grows past
+//		`max_bytes` (0 = no limit) or gets older than `max_age` (a duration
+//		such as "24h"), whichever comes first. keeps `max_backups` backups,
+//		gzipped in the background if `compress` is true.
+//	- timed_rotating_file (path string, format string, interval string,
+//			[compress bool])
+//		interval = hourly | daily | weekly
+//		writes to a new file at every wall clock `interval` boundary, named
+//		after the start of the period eg: path.2024-01-02 for daily. files
+//		of past periods are gzipped in the background if `compress` is true.
+//	- safe (handler HandlerConf, [fallback HandlerConf])
+//		turns a panic in `handler` into an error, reporting it to `fallback`
+//	- sample (rate float64, handler HandlerConf)
+//		keeps a record with probability `rate` [0, 1], and error and crit
+//		records always. the random source is NewRandSource, which tests
+//		may override with a fixed seed
+//	- sentry (dsn string, [level string|int,] handler HandlerConf)
+//		also sends records at or above `level` (warn by default) as events
+//		to the Sentry project at `dsn`, with ctx fields as tags and extra
+//		data and the "stack" of caller_stack or caller_stack_structured as
+//		the stack trace. a malformed `dsn` is BadConf. see SentryHandler
+//	- span_timer (timeout_ms int, handler HandlerConf)
+//		adds duration_ms to event=end records, measured from the event=start
+//		record with the same op_id. starts older than `timeout_ms` are dropped.
+//	- stats (handler HandlerConf)
+//		builds a *LevelCountHandler counting records by level, reported
+//		by Stats and LogSummary for the last one built
 //	- stream (stream string, format string)
 //		stream = stdout | stderr
+//	- swappable (handler HandlerConf)
+//		builds a *SwappableHandler whose inner handler can be replaced at
+//		runtime with Swap
 //	- sync (handler HandlerConf)
-//	- syslog (tag string, format string)
-//	- syslog_net (net string, address string, tag string, format string)
-//	- redis (ip_port string, channel string)
+//	- unique_id (handler HandlerConf)
+//		adds "unique_id", generated once by IDGenerator when the handler is
+//		built, to every record so that all records of a run share it
+//	- syslog (tag string, format string, [facility string])
+//	- syslog_net (net string, address string, tag string, format string,
+//			[facility string])
+//		`facility` = kern | user | mail | daemon | auth | syslog | lpr | news |
+//			uucp | cron | authpriv | ftp | local0 .. local7, user by
+//			default (see SyslogFacility). records are sent with their level
+//			as severity.
+//	- redis (ip_port string, channel string, [mode string, [max_len int]],
+//			[alive_key string, alive_ttl int], [opts RedisOptions])
 //		`ip_port` is of the format "ip:port". port part is optional. on omission
 //			the default redis port 6379 is assumed.
 //		`channel` is the name of the redis channel to which the log statements
 //			are to be written.
+//		`mode` = pubsub | list. pubsub (the default) PUBLISHes to `channel`.
+//			list LPUSHes onto the list named `channel` instead, so that records
+//			are kept while no consumer is connected. `max_len`, when given,
+//			trims the list to its newest `max_len` records.
+//		`alive_key` when given, is SET on every log statement with an expiry
+//			of `alive_ttl` seconds. consumers can check for the existence of
+//			this key (eg: "log:alive:<service>") to know the service is logging.
+//		`opts` sizes the connection pool, eg: RedisOptions{MaxIdle: 4,
+//			MaxActive: 16}. defaults to DefaultRedisMaxIdle and
+//			DefaultRedisMaxActive. it also carries the `Password` to AUTH
+//			with and the `DB` to SELECT, eg: RedisOptions{Password: pw, DB: 3},
+//			and the TLS settings, eg: RedisOptions{TLS: true, CACertPath: path}
+//	- redis_tls (same args as redis)
+//		redis over TLS, ie: with RedisOptions.TLS set
+//	- redis_multi (ip_ports []string, channel string)
+//		publishes to `channel` on every one of the redis instances at
+//		`ip_ports`, succeeding if at least one accepts the record. failed
+//		instances are reconnected to independently.
+//	- tty_stream (stream string, [recheck_ms int])
+//		like stream, but in terminal format while `stream` is a TTY and json
+//		otherwise. the TTY state is checked once unless `recheck_ms` is given,
+//		in which case it is checked again at that interval until Close.
+//		NO_COLOR turns off the colors of the terminal format.
 func MakeHandler(conf HandlerConf) (Handler, error) {
 	if len(conf) < 1 {
-		return nil, BadConf
+		return nil, fmt.Errorf("%w: handler: empty conf", BadConf)
 	}
 
-	name := conf[0].(string)
+	name, ok := conf[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: handler: expected name string, got %T", BadConf, conf[0])
+	}
 	args := conf[1:]
+	what := fmt.Sprintf("handler %q", name)
+
+	if factory := registeredHandler(name); factory != nil {
+		h, err := factory(args)
+		if err != nil {
+			return nil, err
+		}
+
+		if SafeRegisteredHandlers {
+			h = withChildren(SafeHandler(h, nil), h)
+		}
+		return h, nil
+	}
 
 	switch name {
 
+	case "async":
+		// async (bufSize int, overflow string, handler HandlerConf)
+		//		overflow = block | drop_new | drop_old
+
+		if len(args) != 3 {
+			return nil, badArgs(what, "bufSize int, overflow string, handler HandlerConf")
+		}
+
+		bufSize, ok := args[0].(int)
+		if !ok {
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if bufSize < 1 {
+			return nil, badValue(what, 0, "a size of at least 1", args[0])
+		}
+
+		overflow, ok := args[1].(string)
+		if !ok {
+			return nil, badArg(what, 1, "string", args[1])
+		}
+		if overflow != OverflowBlock && overflow != OverflowDropNew && overflow != OverflowDropOld {
+			return nil, badValue(what, 1, "block, drop_new or drop_old", overflow)
+		}
+
+		hdata, ok := args[2].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 2, "HandlerConf", args[2])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		async_h, err := MakeAsyncHandler(bufSize, overflow, h)
+		if err != nil {
+			closeHandler(h)
+			return nil, err
+		}
+
+		return async_h, nil
+
 	case "buffered":
 		// buffered (bufSize int, handler HandlerConf)
 
 		if len(args) != 2 {
-			return nil, BadConf
+			return nil, badArgs(what, "bufSize int, handler HandlerConf")
 		}
 
 		bufSize, ok := args[0].(int)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if bufSize < 0 {
+			return nil, badValue(what, 0, "a size >= 0", args[0])
 		}
 
 		hdata, ok := args[1].(HandlerConf)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 1, "HandlerConf", args[1])
 		}
 
 		h, err := MakeHandler(hdata)
@@ -133,18 +801,28 @@ func MakeHandler(conf HandlerConf) (Handler, error) {
 			return nil, err
 		}
 
-		return log15.BufferedHandler(bufSize, h), nil
+		// like log15.BufferedHandler, but drained when closed
+		if bufSize == 0 {
+			bufSize = 1
+		}
+		buf_h, err := MakeAsyncHandler(bufSize, OverflowBlock, h)
+		if err != nil {
+			closeHandler(h)
+			return nil, err
+		}
+
+		return buf_h, nil
 
 	case "caller_file":
 		// caller_file (handler HandlerConf)
 
 		if len(args) != 1 {
-			return nil, BadConf
+			return nil, badArgs(what, "handler HandlerConf")
 		}
 
 		hdata, ok := args[0].(HandlerConf)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "HandlerConf", args[0])
 		}
 
 		h, err := MakeHandler(hdata)
@@ -152,18 +830,18 @@ func MakeHandler(conf HandlerConf) (Handler, error) {
 			return nil, err
 		}
 
-		return log15.CallerFileHandler(h), nil
+		return withChildren(log15.CallerFileHandler(h), h), nil
 
 	case "caller_func":
 		// caller_func (handler HandlerConf)
 
 		if len(args) != 1 {
-			return nil, BadConf
+			return nil, badArgs(what, "handler HandlerConf")
 		}
 
 		hdata, ok := args[0].(HandlerConf)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "HandlerConf", args[0])
 		}
 
 		h, err := MakeHandler(hdata)
@@ -171,23 +849,42 @@ func MakeHandler(conf HandlerConf) (Handler, error) {
 			return nil, err
 		}
 
-		return log15.CallerFuncHandler(h), nil
+		return withChildren(log15.CallerFuncHandler(h), h), nil
+
+	case "caller_pkg":
+		// caller_pkg (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(CallerPkgHandler(h), h), nil
 
 	case "caller_stack":
 		// caller_stack (format string, handler HandlerConf)
 
 		if len(args) != 2 {
-			return nil, BadConf
+			return nil, badArgs(what, "format string, handler HandlerConf")
 		}
 
 		format, ok := args[0].(string)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "string", args[0])
 		}
 
 		hdata, ok := args[1].(HandlerConf)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 1, "HandlerConf", args[1])
 		}
 
 		h, err := MakeHandler(hdata)
@@ -195,90 +892,94 @@ func MakeHandler(conf HandlerConf) (Handler, error) {
 			return nil, err
 		}
 
-		return log15.CallerStackHandler(format, h), nil
+		return withChildren(log15.CallerStackHandler(format, h), h), nil
 
-	case "discard":
-		// discard ()
+	case "caller_stack_structured":
+		// caller_stack_structured (depth int, handler HandlerConf)
 
-		if len(args) != 0 {
-			return nil, BadConf
+		if len(args) != 2 {
+			return nil, badArgs(what, "depth int, handler HandlerConf")
 		}
 
-		return log15.DiscardHandler(), nil
+		depth, ok := args[0].(int)
+		if !ok {
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if depth < 1 {
+			return nil, badValue(what, 0, "a depth of at least 1", args[0])
+		}
 
-	case "failover":
-		// failover (handler ...HandlerConf)
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
 
-		hs := make([]log15.Handler, len(args))
-		for i := 0; i < len(args); i++ {
-			h, err := MakeHandler(args[i].(HandlerConf))
-			if err != nil {
-				return nil, err
-			}
-			hs = append(hs, h)
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
 		}
 
-		return log15.FailoverHandler(hs...), nil
+		return withChildren(CallerStackStructuredHandler(depth, h), h), nil
 
-	case "file":
-		// file (path string, format string)
+	case "cloudwatch":
+		// cloudwatch (group string, stream string, region string, [format string])
 
-		if len(args) != 2 {
-			return nil, BadConf
+		if len(args) != 3 && len(args) != 4 {
+			return nil, badArgs(what, "group string, stream string, region string, [format string]")
 		}
 
-		path, ok := args[0].(string)
+		group, ok := args[0].(string)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "string", args[0])
 		}
 
-		formatter, err := MakeFormatter(args[1])
-		if err != nil {
-			return nil, err
+		stream, ok := args[1].(string)
+		if !ok {
+			return nil, badArg(what, 1, "string", args[1])
 		}
 
-		return log15.FileHandler(path, formatter)
-
-	case "lazy":
-		// lazy (handler HandlerConf)
+		region, ok := args[2].(string)
+		if !ok {
+			return nil, badArg(what, 2, "string", args[2])
+		}
 
-		if len(args) != 1 {
-			return nil, BadConf
+		var format FormatConf = "json"
+		if len(args) == 4 {
+			format = args[3]
 		}
 
-		hdata, ok := args[0].(HandlerConf)
-		if !ok {
-			return nil, BadConf
+		formatter, err := MakeFormatter(format)
+		if err != nil {
+			return nil, err
 		}
 
-		h, err := MakeHandler(hdata)
+		cw_h, err := MakeCloudWatchHandler(group, stream, region, formatter)
 		if err != nil {
 			return nil, err
 		}
 
-		return log15.LazyHandler(h), nil
+		return cw_h, nil
 
-	case "level_filter":
-		// level_filter (level string, handler HandlerConf)
-		//		level = debug | info | warn | error | crit
+	case "dedup":
+		// dedup (window string, handler HandlerConf)
 
 		if len(args) != 2 {
-			return nil, BadConf
+			return nil, badArgs(what, "window string, handler HandlerConf")
 		}
 
-		lvlString, ok := args[0].(string)
+		windowString, ok := args[0].(string)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "string", args[0])
 		}
 
-		lvl, err := log15.LvlFromString(lvlString)
-		if err != nil {
-			return nil, BadConf
+		window, err := time.ParseDuration(windowString)
+		if err != nil || window <= 0 {
+			return nil, badValue(what, 0, "a duration > 0", windowString)
 		}
 
 		hdata, ok := args[1].(HandlerConf)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 1, "HandlerConf", args[1])
 		}
 
 		h, err := MakeHandler(hdata)
@@ -286,28 +987,34 @@ func MakeHandler(conf HandlerConf) (Handler, error) {
 			return nil, err
 		}
 
-		return log15.LvlFilterHandler(lvl, h), nil
+		return DedupHandler(window, h), nil
 
-	case "match_filter":
-		// match_filter (key string, value string|int|float, handler HandlerConf)
+	case "delayed_sample":
+		// delayed_sample (warmup_ms int, rate float64, handler HandlerConf)
 
 		if len(args) != 3 {
-			return nil, BadConf
+			return nil, badArgs(what, "warmup_ms int, rate float64, handler HandlerConf")
 		}
 
-		key, ok := args[0].(string)
+		warmup, ok := args[0].(int)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if warmup < 0 {
+			return nil, badValue(what, 0, "a duration >= 0", args[0])
 		}
 
-		value, ok := args[1].(interface{})
+		rate, ok := args[1].(float64)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 1, "float64", args[1])
+		}
+		if rate < 0 || rate > 1 {
+			return nil, badValue(what, 1, "a rate between 0 and 1", args[1])
 		}
 
 		hdata, ok := args[2].(HandlerConf)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 2, "HandlerConf", args[2])
 		}
 
 		h, err := MakeHandler(hdata)
@@ -315,87 +1022,1357 @@ func MakeHandler(conf HandlerConf) (Handler, error) {
 			return nil, err
 		}
 
-		return log15.MatchFilterHandler(key, value, h), nil
+		return withChildren(DelayedSampleHandler(time.Duration(warmup)*time.Millisecond, rate, h), h), nil
 
-	case "multi":
-		// multi (handler ...HandlerConf)
+	case "dict_compress":
+		// dict_compress (keys []string, resync_ms int, handler HandlerConf)
 
-		hs := make([]log15.Handler, len(args))
-		for i := 0; i < len(args); i++ {
-			h, err := MakeHandler(args[i].(HandlerConf))
-			if err != nil {
-				return nil, err
-			}
-			hs[i] = h
+		if len(args) != 3 {
+			return nil, badArgs(what, "keys []string, resync_ms int, handler HandlerConf")
 		}
 
-		return log15.MultiHandler(hs...), nil
-
-	case "net":
-		// net (network string, address string, format string)
-
-		if len(args) != 3 {
-			return nil, BadConf
+		keys, ok := args[0].([]string)
+		if !ok {
+			return nil, badArg(what, 0, "[]string", args[0])
+		}
+		if len(keys) == 0 {
+			return nil, badValue(what, 0, "at least one key", args[0])
 		}
 
-		network, ok := args[0].(string)
+		resync, ok := args[1].(int)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 1, "int", args[1])
+		}
+		if resync <= 0 {
+			return nil, badValue(what, 1, "a duration > 0", args[1])
 		}
 
-		address, ok := args[1].(string)
+		hdata, ok := args[2].(HandlerConf)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 2, "HandlerConf", args[2])
 		}
 
-		formatter, err := MakeFormatter(args[2])
+		h, err := MakeHandler(hdata)
 		if err != nil {
 			return nil, err
 		}
 
-		return log15.NetHandler(network, address, formatter)
+		return withChildren(DictCompressHandler(keys, time.Duration(resync)*time.Millisecond, h), h), nil
+
+	case "discard":
+		// discard ()
+
+		if len(args) != 0 {
+			return nil, badArgs(what, "")
+		}
+
+		return log15.DiscardHandler(), nil
+
+	case "error_caller":
+		// error_caller (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(ErrorCallerHandler(h), h), nil
+
+	case "error_stack":
+		// error_stack (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(ErrorStackHandler(h), h), nil
+
+	case "escalate_repeat":
+		// escalate_repeat (threshold int, window_ms int, [from string, to string,]
+		//		handler HandlerConf)
+
+		if len(args) != 3 && len(args) != 5 {
+			return nil, badArgs(what, "threshold int, window_ms int, [from string, to string,] handler HandlerConf")
+		}
+
+		threshold, ok := args[0].(int)
+		if !ok {
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if threshold < 1 {
+			return nil, badValue(what, 0, "a threshold of at least 1", args[0])
+		}
+
+		window, ok := args[1].(int)
+		if !ok {
+			return nil, badArg(what, 1, "int", args[1])
+		}
+		if window <= 0 {
+			return nil, badValue(what, 1, "a duration > 0", args[1])
+		}
+
+		from, to := log15.LvlWarn, log15.LvlError
+		if len(args) == 5 {
+			fromString, ok := args[2].(string)
+			if !ok {
+				return nil, badArg(what, 2, "string", args[2])
+			}
+
+			toString, ok := args[3].(string)
+			if !ok {
+				return nil, badArg(what, 3, "string", args[3])
+			}
+
+			var err error
+			if from, err = log15.LvlFromString(fromString); err != nil {
+				return nil, badValue(what, 2, "a level", fromString)
+			}
+			if to, err = log15.LvlFromString(toString); err != nil {
+				return nil, badValue(what, 3, "a level", toString)
+			}
+		}
+
+		hdata, ok := args[len(args)-1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, len(args)-1, "HandlerConf", args[len(args)-1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(EscalateRepeatHandler(threshold, time.Duration(window)*time.Millisecond,
+			Lvl(from), Lvl(to), h), h), nil
+
+	case "failover":
+		// failover (handler ...HandlerConf)
+
+		hs := make([]log15.Handler, 0, len(args))
+		for i := 0; i < len(args); i++ {
+			hdata, ok := args[i].(HandlerConf)
+			if !ok {
+				for _, h := range hs {
+					closeHandler(h)
+				}
+				return nil, badArg(what, i, "HandlerConf", args[i])
+			}
+
+			h, err := MakeHandler(hdata)
+			if err != nil {
+				for _, h := range hs {
+					closeHandler(h)
+				}
+				return nil, err
+			}
+			hs = append(hs, h)
+		}
+
+		children := make([]interface{}, len(hs))
+		for i, h := range hs {
+			children[i] = h
+		}
+		return withChildren(log15.FailoverHandler(hs...), children...), nil
+
+	case "dual_format":
+		// dual_format (human_format string, json_format string, stream string,
+		//		[json_first bool, separator string])
+
+		if len(args) != 3 && len(args) != 5 {
+			return nil, badArgs(what, "human_format string, json_format string, stream string, [json_first bool, separator string]")
+		}
+
+		human, err := MakeFormatter(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		json, err := MakeFormatter(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		stream, err := getStream(args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		jsonFirst, separator := false, DefaultDualFormatSeparator
+		if len(args) == 5 {
+			var ok bool
+
+			jsonFirst, ok = args[3].(bool)
+			if !ok {
+				return nil, badArg(what, 3, "bool", args[3])
+			}
+
+			separator, ok = args[4].(string)
+			if !ok {
+				return nil, badArg(what, 4, "string", args[4])
+			}
+		}
+
+		if jsonFirst {
+			human, json = json, human
+		}
+
+		return log15.StreamHandler(stream, DualFormat(human, json, separator)), nil
+
+	case "file":
+		// file (path string, format string)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "path string, format string")
+		}
+
+		path, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		formatter, err := MakeFormatter(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		file_h, err := fileHandler(path, formatter)
+		if err != nil {
+			return nil, err
+		}
+
+		return file_h, nil
+
+	case "file_sync":
+		// file_sync (path string, format string, sync_every int)
+
+		if len(args) != 3 {
+			return nil, badArgs(what, "path string, format string, sync_every int")
+		}
+
+		path, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		formatter, err := MakeFormatter(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		syncEvery, ok := args[2].(int)
+		if !ok {
+			return nil, badArg(what, 2, "int", args[2])
+		}
+		if syncEvery < 1 {
+			return nil, badValue(what, 2, "at least 1", syncEvery)
+		}
+
+		file_h, err := fileSyncHandler(path, formatter, syncEvery)
+		if err != nil {
+			return nil, err
+		}
+
+		return file_h, nil
+
+	case "geoip":
+		// geoip (db_path string, ip_key string, handler HandlerConf)
+
+		if len(args) != 3 {
+			return nil, badArgs(what, "db_path string, ip_key string, handler HandlerConf")
+		}
+
+		dbPath, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		ipKey, ok := args[1].(string)
+		if !ok {
+			return nil, badArg(what, 1, "string", args[1])
+		}
+
+		hdata, ok := args[2].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 2, "HandlerConf", args[2])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		db, err := openGeoIPDB(dbPath)
+		if err != nil {
+			closeHandler(h)
+			return nil, err
+		}
+
+		return withChildren(GeoIPHandler(db, ipKey, h), h, geoDBCloser{db}), nil
+
+	case "goroutine_ctx":
+		// goroutine_ctx (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(GoroutineCtxHandler(h), h), nil
+
+	case "http":
+		// http (url string, format string)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "url string, format string")
+		}
+
+		url, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		formatter, err := MakeFormatter(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		http_h, err := MakeHTTPHandler(url, contentType(args[1]), formatter)
+		if err != nil {
+			return nil, err
+		}
+
+		return loopGuard(http_h, nil)
+
+	case "kafka":
+		// kafka (brokers string, topic string, format string, [route string])
+		//		route = topic | level
+
+		if len(args) != 3 && len(args) != 4 {
+			return nil, badArgs(what, "brokers string, topic string, format string, [route string]")
+		}
+
+		brokersString, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		var brokers []string
+		for _, b := range strings.Split(brokersString, ",") {
+			if b = strings.TrimSpace(b); b != "" {
+				brokers = append(brokers, b)
+			}
+		}
+
+		topic, ok := args[1].(string)
+		if !ok {
+			return nil, badArg(what, 1, "string", args[1])
+		}
+
+		formatter, err := MakeFormatter(args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		route := "topic"
+		if len(args) == 4 {
+			if route, ok = args[3].(string); !ok {
+				return nil, badArg(what, 3, "string", args[3])
+			}
+		}
+
+		var kafka_h *KafkaHandler
+		switch route {
+		case "topic":
+			kafka_h, err = MakeKafkaHandler(brokers, topic, formatter)
+		case "level":
+			kafka_h, err = MakeKafkaLevelHandler(brokers, topic, formatter)
+		default:
+			return nil, badValue(what, 3, "topic or level", route)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return loopGuard(kafka_h, nil)
+
+	case "lazy":
+		// lazy (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(log15.LazyHandler(h), h), nil
+
+	case "level_filter":
+		// level_filter (level string|int, handler HandlerConf)
+		//		level = debug | info | warn | error | crit | 0 (crit) ... 4 (debug)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "level string|int, handler HandlerConf")
+		}
+
+		lvl, err := LvlFromAny(args[0])
+		if err != nil {
+			return nil, badValue(what, 0, "a level name or 0-4", args[0])
+		}
+
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(log15.LvlFilterHandler(log15.Lvl(lvl), h), h), nil
+
+	case "level_from_field":
+		// level_from_field (key string, handler HandlerConf)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "key string, handler HandlerConf")
+		}
+
+		key, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(LevelFromFieldHandler(key, h), h), nil
+
+	case "level_route":
+		// level_route (min_level string, handler HandlerConf, ...)
+
+		if len(args) == 0 || len(args)%2 != 0 {
+			return nil, badArgs(what, "min_level string, handler HandlerConf, ...")
+		}
+
+		routes := make([]LevelRoute, 0, len(args)/2)
+		closeRoutes := func() {
+			for _, route := range routes {
+				closeHandler(route.Handler)
+			}
+		}
+
+		for i := 0; i < len(args); i += 2 {
+			lvlString, ok := args[i].(string)
+			if !ok {
+				closeRoutes()
+				return nil, badArg(what, i, "string", args[i])
+			}
+
+			lvl, err := log15.LvlFromString(lvlString)
+			if err != nil {
+				closeRoutes()
+				return nil, badValue(what, i, "a level", lvlString)
+			}
+
+			hdata, ok := args[i+1].(HandlerConf)
+			if !ok {
+				closeRoutes()
+				return nil, badArg(what, i+1, "HandlerConf", args[i+1])
+			}
+
+			h, err := MakeHandler(hdata)
+			if err != nil {
+				closeRoutes()
+				return nil, err
+			}
+			routes = append(routes, LevelRoute{MinLvl: Lvl(lvl), Handler: h})
+		}
+
+		children := make([]interface{}, len(routes))
+		for i, route := range routes {
+			children[i] = route.Handler
+		}
+		return withChildren(LevelRouteHandler(routes), children...), nil
+
+	case "level_router":
+		// level_router (routes map[string]HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "routes map[string]HandlerConf")
+		}
+
+		routeConfs, ok := args[0].(map[string]HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "map[string]HandlerConf", args[0])
+		}
+
+		routes := make(map[Lvl]Handler, len(routeConfs))
+		var children []interface{}
+		closeRoutes := func() {
+			for _, h := range routes {
+				closeHandler(h)
+			}
+		}
+
+		for lvlString, hdata := range routeConfs {
+			lvl, err := log15.LvlFromString(lvlString)
+			if err != nil {
+				closeRoutes()
+				return nil, badValue(what, 0, "level names as keys", lvlString)
+			}
+
+			h, err := MakeHandler(hdata)
+			if err != nil {
+				closeRoutes()
+				return nil, err
+			}
+			routes[Lvl(lvl)] = h
+			children = append(children, h)
+		}
+
+		return withChildren(LevelRouterHandler(routes), children...), nil
+
+	case "level_sample":
+		// level_sample (rates map[string]float64, handler HandlerConf)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "rates map[string]float64, handler HandlerConf")
+		}
+
+		rates, ok := args[0].(map[string]float64)
+		if !ok {
+			return nil, badArg(what, 0, "map[string]float64", args[0])
+		}
+
+		for name, rate := range rates {
+			if _, err := log15.LvlFromString(name); err != nil {
+				return nil, badValue(what, 0, "rates keyed by level name", name)
+			}
+			if rate < 0 || rate > 1 {
+				return nil, badValue(what, 0, "a rate between 0 and 1 for "+name, rate)
+			}
+		}
+
+		lvlRates, err := MakeLevelRates(rates)
+		if err != nil {
+			return nil, err
+		}
+
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(LevelSampleHandler(lvlRates, h), h), nil
+
+	case "logstash":
+		// logstash (address string, [format string])
+
+		if len(args) != 1 && len(args) != 2 {
+			return nil, badArgs(what, "address string, [format string]")
+		}
+
+		address, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		var format FormatConf = "json"
+		if len(args) == 2 {
+			format = args[1]
+		}
+
+		formatter, err := MakeFormatter(format)
+		if err != nil {
+			return nil, err
+		}
+
+		logstash_h, err := MakeLogstashHandler(address, formatter)
+		if err != nil {
+			return nil, err
+		}
+
+		return loopGuard(logstash_h, nil)
+
+	case "match_filter":
+		// match_filter (key string, value string|int|float, handler HandlerConf)
+
+		if len(args) != 3 {
+			return nil, badArgs(what, "key string, value string|int|float, handler HandlerConf")
+		}
+
+		key, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		value, err := matchValue(what, 1, args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		hdata, ok := args[2].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 2, "HandlerConf", args[2])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(log15.MatchFilterHandler(key, value, h), h), nil
+
+	case "match_all", "match_any":
+		// match_all (fields map[string]interface{} | key string, value string|int|float, ..., handler HandlerConf)
+		// match_any (fields map[string]interface{} | key string, value string|int|float, ..., handler HandlerConf)
+
+		if len(args) < 2 {
+			return nil, badArgs(what, matchArgs)
+		}
+
+		fields, err := matchFields(what, args[:len(args)-1])
+		if err != nil {
+			return nil, err
+		}
+
+		hdata, ok := args[len(args)-1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, len(args)-1, "HandlerConf", args[len(args)-1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "match_all" {
+			return withChildren(MatchAllHandler(fields, h), h), nil
+		}
+		return withChildren(MatchAnyHandler(fields, h), h), nil
+
+	case "not_match_filter":
+		// not_match_filter (key string, value string|int|float, handler HandlerConf)
+
+		if len(args) != 3 {
+			return nil, badArgs(what, "key string, value string|int|float, handler HandlerConf")
+		}
+
+		key, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		value, err := matchValue(what, 1, args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		hdata, ok := args[2].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 2, "HandlerConf", args[2])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(NotMatchFilterHandler(key, value, h), h), nil
+
+	case "metrics":
+		// metrics (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(MetricsHandler(h), h), nil
+
+	case "monotonic":
+		// monotonic (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(MonotonicHandler(h), h), nil
+
+	case "multi":
+		// multi ([priority int,] handler HandlerConf, ...)
+
+		var (
+			hs         []Handler
+			priorities []int
+			priority   int
+			annotated  bool
+		)
+		for i := 0; i < len(args); i++ {
+			if p, ok := args[i].(int); ok {
+				priority, annotated = p, true
+				continue
+			}
+
+			hdata, ok := args[i].(HandlerConf)
+			if !ok {
+				for _, h := range hs {
+					closeHandler(h)
+				}
+				return nil, badArg(what, i, "HandlerConf", args[i])
+			}
+
+			h, err := MakeHandler(hdata)
+			if err != nil {
+				for _, h := range hs {
+					closeHandler(h)
+				}
+				return nil, err
+			}
+			hs = append(hs, h)
+			priorities = append(priorities, priority)
+			priority = 0
+		}
+
+		if !annotated {
+			priorities = nil
+		}
+
+		h, err := MakeMultiHandler(hs, priorities)
+		if err != nil {
+			return nil, err
+		}
+
+		return h, nil
+
+	case "net":
+		// net (network string, address string, format string)
+
+		if len(args) != 3 {
+			return nil, badArgs(what, "network string, address string, format string")
+		}
+
+		network, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		address, ok := args[1].(string)
+		if !ok {
+			return nil, badArg(what, 1, "string", args[1])
+		}
+
+		formatter, err := MakeFormatter(args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		net_h, err := netHandler(network, address, formatter)
+		if err != nil {
+			return nil, err
+		}
+
+		return loopGuard(net_h, nil)
+
+	case "net_reconnect":
+		// net_reconnect (network string, address string, format string)
+
+		if len(args) != 3 {
+			return nil, badArgs(what, "network string, address string, format string")
+		}
+
+		network, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		address, ok := args[1].(string)
+		if !ok {
+			return nil, badArg(what, 1, "string", args[1])
+		}
+
+		formatter, err := MakeFormatter(args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		net_h, err := MakeNetReconnectHandler(network, address, formatter)
+		if err != nil {
+			return nil, err
+		}
+
+		return loopGuard(net_h, nil)
+
+	case "project_fields", "drop_fields":
+		// project_fields (allow []string, handler HandlerConf)
+		// drop_fields (deny []string, handler HandlerConf)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "allow []string, handler HandlerConf")
+		}
+
+		keys, ok := args[0].([]string)
+		if !ok {
+			return nil, badArg(what, 0, "[]string", args[0])
+		}
+
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(ProjectFieldsHandler(keys, name == "project_fields", h), h), nil
+
+	case "rate_limit":
+		// rate_limit (per_second int, handler HandlerConf)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "per_second int, handler HandlerConf")
+		}
+
+		perSecond, ok := args[0].(int)
+		if !ok {
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if perSecond < 1 {
+			return nil, badValue(what, 0, "a rate of at least 1", args[0])
+		}
+
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(RateLimitHandler(perSecond, h), h), nil
+
+	case "redact":
+		// redact (keys []string, replacement string, handler HandlerConf)
+
+		if len(args) != 3 {
+			return nil, badArgs(what, "keys []string, replacement string, handler HandlerConf")
+		}
+
+		keys, ok := args[0].([]string)
+		if !ok {
+			return nil, badArg(what, 0, "[]string", args[0])
+		}
+
+		replacement, ok := args[1].(string)
+		if !ok {
+			return nil, badArg(what, 1, "string", args[1])
+		}
+
+		hdata, ok := args[2].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 2, "HandlerConf", args[2])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(RedactHandler(keys, replacement, h), h), nil
+
+	case "redact_patterns", "redact_pattern":
+		// redact_patterns (patterns []string, [mask string,] handler HandlerConf)
+
+		if len(args) != 2 && len(args) != 3 {
+			return nil, badArgs(what, "patterns []string, [mask string,] handler HandlerConf")
+		}
+
+		patterns, ok := args[0].([]string)
+		if !ok {
+			return nil, badArg(what, 0, "[]string", args[0])
+		}
+
+		res, err := CompileRedactPatterns(patterns)
+		if err != nil {
+			return nil, err
+		}
+
+		mask := ""
+		if len(args) == 3 {
+			mask, ok = args[1].(string)
+			if !ok {
+				return nil, badArg(what, 1, "string", args[1])
+			}
+		}
+
+		hdata, ok := args[len(args)-1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, len(args)-1, "HandlerConf", args[len(args)-1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(RedactPatternsHandler(res, mask, h), h), nil
+
+	case "request_buffer":
+		// request_buffer (keep_errors bool, handler HandlerConf)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "keep_errors bool, handler HandlerConf")
+		}
+
+		keepErrors, ok := args[0].(bool)
+		if !ok {
+			return nil, badArg(what, 0, "bool", args[0])
+		}
+
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return MakeRequestBufferHandler(keepErrors, h), nil
+
+	case "rotating_file":
+		// rotating_file (path string, format string, max_bytes int, max_backups int,
+		//		[compress bool, [max_age string]])
+
+		if len(args) < 4 || len(args) > 6 {
+			return nil, badArgs(what, "path string, format string, max_bytes int, max_backups int, [compress bool, [max_age string]]")
+		}
+
+		path, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		formatter, err := MakeFormatter(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		maxBytes, ok := args[2].(int)
+		if !ok {
+			return nil, badArg(what, 2, "int", args[2])
+		}
+		if maxBytes < 0 {
+			return nil, badValue(what, 2, "a size >= 0", args[2])
+		}
+
+		maxBackups, ok := args[3].(int)
+		if !ok {
+			return nil, badArg(what, 3, "int", args[3])
+		}
+		if maxBackups < 1 {
+			return nil, badValue(what, 3, "at least 1 backup", args[3])
+		}
+
+		rf := &RotatingFile{Path: path, MaxBytes: int64(maxBytes), MaxBackups: maxBackups}
+
+		if len(args) >= 5 {
+			rf.Compress, ok = args[4].(bool)
+			if !ok {
+				return nil, badArg(what, 4, "bool", args[4])
+			}
+		}
+
+		if len(args) == 6 {
+			maxAge, ok := args[5].(string)
+			if !ok {
+				return nil, badArg(what, 5, "string", args[5])
+			}
+
+			rf.MaxAge, err = time.ParseDuration(maxAge)
+			if err != nil || rf.MaxAge < 0 {
+				return nil, badValue(what, 5, "a duration >= 0", maxAge)
+			}
+		}
+
+		if err := rf.Open(); err != nil {
+			return nil, err
+		}
+
+		return &closingHandler{Handler: log15.StreamHandler(rf, formatter), c: rf}, nil
+
+	case "timed_rotating_file":
+		// timed_rotating_file (path string, format string, interval string,
+		//		[compress bool])
+		//		interval = hourly | daily | weekly
+
+		if len(args) != 3 && len(args) != 4 {
+			return nil, badArgs(what, "path string, format string, interval string, [compress bool]")
+		}
+
+		path, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		formatter, err := MakeFormatter(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		interval, ok := args[2].(string)
+		if !ok {
+			return nil, badArg(what, 2, "string", args[2])
+		}
+
+		rf := &TimedRotatingFile{Path: path, Interval: interval}
+
+		if len(args) == 4 {
+			rf.Compress, ok = args[3].(bool)
+			if !ok {
+				return nil, badArg(what, 3, "bool", args[3])
+			}
+		}
+
+		if err := rf.Open(); err != nil {
+			return nil, err
+		}
+
+		return &closingHandler{Handler: log15.StreamHandler(rf, formatter), c: rf}, nil
+
+	case "max_depth":
+		// max_depth (depth int, handler HandlerConf)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "depth int, handler HandlerConf")
+		}
+
+		depth, ok := args[0].(int)
+		if !ok {
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if depth < 0 {
+			return nil, badValue(what, 0, "a depth >= 0", args[0])
+		}
+
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(MaxDepthHandler(depth, h), h), nil
+
+	case "ring":
+		// ring (size int, [format string,] handler HandlerConf)
+
+		if len(args) != 2 && len(args) != 3 {
+			return nil, badArgs(what, "size int, [format string,] handler HandlerConf")
+		}
+
+		size, ok := args[0].(int)
+		if !ok {
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if size < 1 {
+			return nil, badValue(what, 0, "a size of at least 1", size)
+		}
+
+		var format FormatConf = "json"
+		if len(args) == 3 {
+			format = args[1]
+		}
+
+		hdata, ok := args[len(args)-1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, len(args)-1, "HandlerConf", args[len(args)-1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		ring_h, err := MakeRingHandler(size, format, h)
+		if err != nil {
+			closeHandler(h)
+			return nil, err
+		}
+
+		return ring_h, nil
+
+	case "safe":
+		// safe (handler HandlerConf, [fallback HandlerConf])
+
+		if len(args) != 1 && len(args) != 2 {
+			return nil, badArgs(what, "handler HandlerConf, [fallback HandlerConf]")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		var fallback Handler
+		if len(args) == 2 {
+			fdata, ok := args[1].(HandlerConf)
+			if !ok {
+				closeHandler(h)
+				return nil, badArg(what, 1, "HandlerConf", args[1])
+			}
+
+			fallback, err = MakeHandler(fdata)
+			if err != nil {
+				closeHandler(h)
+				return nil, err
+			}
+		}
+
+		return withChildren(SafeHandler(h, fallback), h, fallback), nil
+
+	case "sample":
+		// sample (rate float64, handler HandlerConf)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "rate float64, handler HandlerConf")
+		}
+
+		rate, ok := args[0].(float64)
+		if !ok {
+			return nil, badArg(what, 0, "float64", args[0])
+		}
+		if rate < 0 || rate > 1 {
+			return nil, badValue(what, 0, "a rate between 0 and 1", args[0])
+		}
+
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(SampleHandler(rate, h), h), nil
+
+	case "sentry":
+		// sentry (dsn string, [level string|int,] handler HandlerConf)
+
+		if len(args) != 2 && len(args) != 3 {
+			return nil, badArgs(what, "dsn string, [level string|int,] handler HandlerConf")
+		}
+
+		dsn, ok := args[0].(string)
+		if !ok {
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		minLvl := LvlWarn
+		if len(args) == 3 {
+			lvl, err := LvlFromAny(args[1])
+			if err != nil {
+				return nil, badValue(what, 1, "a level name or 0-4", args[1])
+			}
+			minLvl = lvl
+		}
+
+		hdata, ok := args[len(args)-1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, len(args)-1, "HandlerConf", args[len(args)-1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		sentry_h, err := MakeSentryHandler(dsn, minLvl, h)
+		if err != nil {
+			closeHandler(h)
+			return nil, err
+		}
+
+		return sentry_h, nil
+
+	case "span_timer":
+		// span_timer (timeout_ms int, handler HandlerConf)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "timeout_ms int, handler HandlerConf")
+		}
+
+		timeout, ok := args[0].(int)
+		if !ok {
+			return nil, badArg(what, 0, "int", args[0])
+		}
+		if timeout <= 0 {
+			return nil, badValue(what, 0, "a duration > 0", args[0])
+		}
+
+		hdata, ok := args[1].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 1, "HandlerConf", args[1])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(SpanTimerHandler(time.Duration(timeout)*time.Millisecond, h), h), nil
+
+	case "stats":
+		// stats (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return StatsHandler(h), nil
 
 	case "stream":
 		// stream (stream string, format string)
 		//		stream = stdout | stderr
 
 		if len(args) != 2 {
-			return nil, BadConf
+			return nil, badArgs(what, "stream string, format string")
 		}
 
-		stream_name, ok := args[0].(string)
-		if !ok {
-			return nil, BadConf
+		stream, err := getStream(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		formatter, err := MakeFormatter(args[1])
+		if err != nil {
+			return nil, err
 		}
 
-		var stream io.Writer
+		return log15.StreamHandler(stream, streamFormat(formatter, stream)), nil
 
-		switch stream_name {
-		case "stdout":
-			stream = os.Stdout
-		case "stderr", "":
-			stream = os.Stderr
-		default:
-			return nil, BadConf
+	case "swappable":
+		// swappable (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
 		}
 
-		formatter, err := MakeFormatter(args[1])
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
 		if err != nil {
 			return nil, err
 		}
 
-		return log15.StreamHandler(stream, formatter), nil
+		return MakeSwappableHandler(h), nil
 
 	case "sync":
 		// sync (handler HandlerConf)
 
 		if len(args) != 1 {
-			return nil, BadConf
+			return nil, badArgs(what, "handler HandlerConf")
 		}
 
 		hdata, ok := args[0].(HandlerConf)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "HandlerConf", args[0])
 		}
 
 		h, err := MakeHandler(hdata)
@@ -403,18 +2380,18 @@ func MakeHandler(conf HandlerConf) (Handler, error) {
 			return nil, err
 		}
 
-		return log15.SyncHandler(h), nil
+		return withChildren(log15.SyncHandler(h), h), nil
 
 	case "syslog":
-		// syslog (tag string, format string)
+		// syslog (tag string, format string, [facility string])
 
-		if len(args) != 2 {
-			return nil, BadConf
+		if len(args) != 2 && len(args) != 3 {
+			return nil, badArgs(what, "tag string, format string, [facility string]")
 		}
 
 		tag, ok := args[0].(string)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "string", args[0])
 		}
 
 		formatter, err := MakeFormatter(args[1])
@@ -422,28 +2399,41 @@ func MakeHandler(conf HandlerConf) (Handler, error) {
 			return nil, err
 		}
 
-		return log15.SyslogHandler(syslog.LOG_DEBUG, tag, formatter)
+		facility := SyslogFacility
+		if len(args) == 3 {
+			name, ok := args[2].(string)
+			if !ok {
+				return nil, badArg(what, 2, "string", args[2])
+			}
+
+			if facility, err = SyslogFacilityFromString(name); err != nil {
+				return nil, err
+			}
+		}
+
+		return log15.SyslogHandler(facility|syslog.LOG_DEBUG, tag, formatter)
 
 	case "syslog_net":
-		// syslog_net (net string, address string, tag string, format string)
+		// syslog_net (net string, address string, tag string, format string,
+		//		[facility string])
 
-		if len(args) != 4 {
-			return nil, BadConf
+		if len(args) != 4 && len(args) != 5 {
+			return nil, badArgs(what, "net string, address string, tag string, format string, [facility string]")
 		}
 
 		network, ok := args[0].(string)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "string", args[0])
 		}
 
 		address, ok := args[1].(string)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 1, "string", args[1])
 		}
 
 		tag, ok := args[2].(string)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 2, "string", args[2])
 		}
 
 		formatter, err := MakeFormatter(args[3])
@@ -451,88 +2441,458 @@ func MakeHandler(conf HandlerConf) (Handler, error) {
 			return nil, err
 		}
 
-		return log15.SyslogNetHandler(network, address, syslog.LOG_DEBUG, tag, formatter)
+		facility := SyslogFacility
+		if len(args) == 5 {
+			name, ok := args[4].(string)
+			if !ok {
+				return nil, badArg(what, 4, "string", args[4])
+			}
+
+			if facility, err = SyslogFacilityFromString(name); err != nil {
+				return nil, err
+			}
+		}
+
+		return log15.SyslogNetHandler(network, address, facility|syslog.LOG_DEBUG, tag, formatter)
 
-	case "redis":
-		// redis (ip_port string, channel string)
+	case "redis", "redis_tls":
+		// redis (ip_port string, channel string, [mode string, [max_len int]],
+		//		[alive_key string, alive_ttl int], [opts RedisOptions])
+		//		mode = pubsub | list
+		// redis_tls (same as redis)
 
-		if len(args) != 2 {
-			return nil, BadConf
+		var opts RedisOptions
+		if len(args) > 0 {
+			var ok bool
+			if opts, ok = args[len(args)-1].(RedisOptions); ok {
+				args = args[:len(args)-1]
+			}
+		}
+
+		if len(args) < 2 {
+			return nil, badArgs(what, redisArgs)
 		}
 
 		ip_port, ok := args[0].(string)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 0, "string", args[0])
+		}
+
+		channel, ok := args[1].(string)
+		if !ok {
+			return nil, badArg(what, 1, "string", args[1])
+		}
+
+		if name == "redis_tls" {
+			opts.TLS = true
+		}
+
+		redis_h := &RedisHandler{Loc: ip_port, Channel: channel, Options: opts}
+		args, pos := args[2:], 2
+
+		if len(args) > 0 && (args[0] == "pubsub" || args[0] == "list") {
+			redis_h.Mode = args[0].(string)
+			args, pos = args[1:], pos+1
+
+			if len(args) > 0 && redis_h.Mode == "list" {
+				if maxLen, ok := args[0].(int); ok {
+					if maxLen <= 0 {
+						return nil, badValue(what, pos, "a length > 0", maxLen)
+					}
+					redis_h.MaxLen = maxLen
+					args, pos = args[1:], pos+1
+				}
+			}
+		}
+
+		if len(args) != 0 && len(args) != 2 {
+			return nil, badArgs(what, redisArgs)
+		}
+
+		if len(args) == 2 {
+			redis_h.AliveKey, ok = args[0].(string)
+			if !ok {
+				return nil, badArg(what, pos, "string", args[0])
+			}
+			if redis_h.AliveKey == "" {
+				return nil, badValue(what, pos, "a non empty key", args[0])
+			}
+
+			redis_h.AliveTTL, ok = args[1].(int)
+			if !ok {
+				return nil, badArg(what, pos+1, "int", args[1])
+			}
+			if redis_h.AliveTTL <= 0 {
+				return nil, badValue(what, pos+1, "a ttl > 0", args[1])
+			}
+		}
+
+		err := redis_h.Init()
+		if err != nil {
+			redis_h.Close()
+			return nil, err
+		}
+
+		return loopGuard(redis_h, nil)
+
+	case "redis_multi":
+		// redis_multi (ip_ports []string, channel string)
+
+		if len(args) != 2 {
+			return nil, badArgs(what, "ip_ports []string, channel string")
+		}
+
+		ip_ports, ok := args[0].([]string)
+		if !ok {
+			return nil, badArg(what, 0, "[]string", args[0])
+		}
+		if len(ip_ports) == 0 {
+			return nil, badValue(what, 0, "at least one address", args[0])
 		}
 
 		channel, ok := args[1].(string)
 		if !ok {
-			return nil, BadConf
+			return nil, badArg(what, 1, "string", args[1])
 		}
 
-		redis_h := RedisHandler{Loc: ip_port, Channel: channel}
+		redis_h := &RedisMultiHandler{Locs: ip_ports, Channel: channel}
 		err := redis_h.Init()
 		if err != nil {
 			return nil, err
 		}
 
-		return log15.SyncHandler(redis_h), nil
+		return loopGuard(redis_h, nil)
+
+	case "unique_id":
+		// unique_id (handler HandlerConf)
+
+		if len(args) != 1 {
+			return nil, badArgs(what, "handler HandlerConf")
+		}
+
+		hdata, ok := args[0].(HandlerConf)
+		if !ok {
+			return nil, badArg(what, 0, "HandlerConf", args[0])
+		}
+
+		h, err := MakeHandler(hdata)
+		if err != nil {
+			return nil, err
+		}
+
+		return withChildren(UniqueIDHandler(h), h), nil
+
+	case "tty_stream":
+		// tty_stream (stream string, [recheck_ms int])
+
+		if len(args) != 1 && len(args) != 2 {
+			return nil, badArgs(what, "stream string, [recheck_ms int]")
+		}
+
+		stream, err := getStream(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		recheck := 0
+		if len(args) == 2 {
+			var ok bool
+			recheck, ok = args[1].(int)
+			if !ok {
+				return nil, badArg(what, 1, "int", args[1])
+			}
+			if recheck < 0 {
+				return nil, badValue(what, 1, "a duration >= 0", args[1])
+			}
+		}
+
+		return TTYStreamHandler(stream, time.Duration(recheck)*time.Millisecond), nil
 
 	default:
-		return nil, BadConf
+		return nil, fmt.Errorf("%w: unknown handler %q", BadConf, name)
+	}
+
+}
+
+// MustHandler is another name for MustMakeHandler, eg: for a package
+// level var
+//	var auditLog = log.MustHandler(log.HandlerConf{"file", "audit.log", "json"})
+func MustHandler(conf HandlerConf) Handler {
+	return MustMakeHandler(conf)
+}
+
+// closeHandler closes @h if it holds resources (eg: an open file).
+// It is used to not leak them when a sibling fails to build.
+func closeHandler(h Handler) {
+	closeTree(h)
+}
+
+// getStream maps a stream name (stdout | stderr) to the stream itself.
+// An empty name means stderr.
+func getStream(name interface{}) (*os.File, error) {
+	stream_name, ok := name.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: stream: expected string, got %T", BadConf, name)
+	}
+
+	switch stream_name {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr", "":
+		return os.Stderr, nil
 	}
 
+	return nil, fmt.Errorf("%w: unknown stream %q", BadConf, stream_name)
+}
+
+// RedisOptions tune the connections of a RedisHandler. Zero values of
+// the pool sizes take the defaults DefaultRedisMaxIdle and
+// DefaultRedisMaxActive.
+type RedisOptions struct {
+	MaxIdle   int // connections kept open while unused
+	MaxActive int // connections open at once. Log waits for a free one
+
+	Password string // AUTH with this password if set
+	DB       int    // SELECT this database if not 0
+
+	TLS           bool   // connect over TLS
+	TLSSkipVerify bool   // don't verify the server's certificate
+	CACertPath    string // PEM file of the CA(s) the server's certificate must chain to
 }
 
+const (
+	DefaultRedisMaxIdle   = 8
+	DefaultRedisMaxActive = 64
+)
+
 type RedisHandler struct {
 	Loc     string
 	Channel string
 
-	conn      redis.Conn
+	// Mode is "pubsub" (the default) to PUBLISH records to Channel
+	// or "list" to LPUSH them onto the list named Channel, trimmed to
+	// the newest MaxLen records if MaxLen > 0
+	Mode   string
+	MaxLen int
+
+	// AliveKey, when set, is refreshed on every log with an expiry of
+	// AliveTTL seconds to act as a log-liveness signal
+	AliveKey string
+	AliveTTL int
+
+	Options RedisOptions
+
+	pool      *redis.Pool
 	formatter log15.Format
 }
 
 func (p *RedisHandler) Init() error {
-	var err error
+	if p.Mode != "" && p.Mode != "pubsub" && p.Mode != "list" {
+		return fmt.Errorf("%w: unknown redis mode %q", BadConf, p.Mode)
+	}
+
 	p.formatter = log15.JsonFormat()
-	p.conn, err = redis.Dial("tcp", p.Loc)
-	return err
+
+	dialOpts := []redis.DialOption{
+		redis.DialPassword(p.Options.Password),
+		redis.DialDatabase(p.Options.DB),
+	}
+
+	if p.Options.TLS {
+		tlsConf := &tls.Config{}
+		if p.Options.CACertPath != "" {
+			pem, err := ioutil.ReadFile(p.Options.CACertPath)
+			if err != nil {
+				return err
+			}
+
+			tlsConf.RootCAs = x509.NewCertPool()
+			if !tlsConf.RootCAs.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("log: no certificates in %s", p.Options.CACertPath)
+			}
+		}
+
+		dialOpts = append(dialOpts,
+			redis.DialUseTLS(true),
+			redis.DialTLSSkipVerify(p.Options.TLSSkipVerify),
+			redis.DialTLSConfig(tlsConf))
+	}
+
+	maxIdle, maxActive := p.Options.MaxIdle, p.Options.MaxActive
+	if maxIdle <= 0 {
+		maxIdle = DefaultRedisMaxIdle
+	}
+	if maxActive <= 0 {
+		maxActive = DefaultRedisMaxActive
+	}
+
+	p.pool = &redis.Pool{
+		MaxIdle:     maxIdle,
+		MaxActive:   maxActive,
+		Wait:        true,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", p.Loc, dialOpts...)
+		},
+		// discard connections that went stale while idle
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Second {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+
+	// connect right away so that a bad address, a failing
+	// TLS handshake or AUTH is reported by MakeHandler
+	conn := p.pool.Get()
+	defer conn.Close()
+	if err := conn.Err(); err != nil {
+		return fmt.Errorf("log: redis %s: %v", p.Loc, err)
+	}
+	return nil
 }
 
-func (p RedisHandler) Log(r *log15.Record) error {
+// Log publishes @r to the channel (or pushes it onto the list) on a
+// connection from the pool. A command that fails (eg: the connection was
+// dropped) is retried once on a fresh connection. Only that command is
+// retried, so a record is never sent again because trimming the list or
+// refreshing AliveKey failed after it was sent.
+func (p *RedisHandler) Log(r *log15.Record) error {
 	b := p.formatter.Format(r)
-	_, err := p.conn.Do("PUBLISH", p.Channel, b)
+
+	conn := p.pool.Get()
+	defer func() { conn.Close() }()
+
+	do := func(cmd string, args ...interface{}) error {
+		_, err := conn.Do(cmd, args...)
+		if err != nil {
+			conn.Close()
+			conn = p.pool.Get()
+			_, err = conn.Do(cmd, args...)
+		}
+		return err
+	}
+
+	var err error
+	if p.Mode == "list" {
+		err = do("LPUSH", p.Channel, b)
+		if err == nil && p.MaxLen > 0 {
+			err = do("LTRIM", p.Channel, 0, p.MaxLen-1)
+		}
+	} else {
+		err = do("PUBLISH", p.Channel, b)
+	}
+	if err != nil {
+		return err
+	}
+
+	if p.AliveKey != "" {
+		err = do("SET", p.AliveKey, 1, "EX", p.AliveTTL)
+	}
+
 	return err
 }
 
+// Close closes the pooled connections
+func (p *RedisHandler) Close() error {
+	if p.pool == nil {
+		return nil
+	}
+	return p.pool.Close()
+}
+
 // MakeBasicHandler prepares a log handler that writes to both
 // a file at @fpath and stderr both with log level @lvl
 // if @fpath is "", then it assumes it shouldn't write to a file
 // and if @quiet is true, then it doesn't print to stderr
 func MakeBasicHandler(fpath, lvl string, quiet bool) (Handler, error) {
-	var (
-		fileHandlerConf   HandlerConf = HandlerConf{"discard"}
-		streamHandlerConf HandlerConf = HandlerConf{"discard"}
-	)
-	if fpath != "" {
-		fileHandlerConf = HandlerConf{"file", fpath, "json"}
-	}
-	if !quiet {
-		if terminal.IsTerminal(int(os.Stdout.Fd())) {
-			streamHandlerConf = HandlerConf{"stream", "stderr", "terminal"}
-		} else {
-			streamHandlerConf = HandlerConf{"stream", "stderr", "json"}
-		}
-	}
-
-	finalHandlerConf := HandlerConf{
-		"level_filter", lvl, HandlerConf{
-			"caller_file", HandlerConf{
-				"multi", fileHandlerConf, streamHandlerConf,
-			},
-		},
+	return MakeBasicHandlerOpts(BasicOptions{Path: fpath, Level: lvl, Quiet: quiet})
+}
+
+// BasicOptions configure MakeBasicHandlerOpts. The zero values of the
+// optional fields give the behavior of MakeBasicHandler.
+type BasicOptions struct {
+	Path  string // file to write to, "" for none
+	Level string // level_filter level
+	Quiet bool   // don't write to stderr
+
+	// FileFormat is the format of the file sink. Defaults to "json"
+	FileFormat FormatConf
+
+	// StreamFormat is the format of the stderr sink. Defaults to
+	// "terminal_color" when stderr is a terminal or ForceColorEnv is set
+	// and "json" otherwise. NoColorEnv turns the colors off.
+	StreamFormat FormatConf
+
+	// Extra is an optional additional sink with its own format,
+	// eg: HandlerConf{"net", "udp", "graylog:12201", "json"}
+	Extra HandlerConf
+}
+
+// MakeBasicHandlerOpts is MakeBasicHandler with more control over the
+// formats of the sinks and an optional extra sink. Each sink is built on
+// its own so that an error names the sink whose configuration is bad.
+func MakeBasicHandlerOpts(opts BasicOptions) (Handler, error) {
+	lvl, err := log15.LvlFromString(opts.Level)
+	if err != nil {
+		return nil, fmt.Errorf("%w: level %q: %v", BadConf, opts.Level, err)
+	}
+
+	type sink struct {
+		name string
+		conf HandlerConf
+	}
+	var sinks []sink
+
+	if opts.Path != "" {
+		format := opts.FileFormat
+		if format == nil {
+			format = "json"
+		}
+		if _, err := MakeFormatter(format); err != nil {
+			return nil, fmt.Errorf("file sink format: %w", err)
+		}
+
+		sinks = append(sinks, sink{"file", HandlerConf{"file", opts.Path, format}})
+	}
+	if !opts.Quiet {
+		format := opts.StreamFormat
+		if format == nil {
+			if terminal.IsTerminal(int(os.Stderr.Fd())) || os.Getenv(ForceColorEnv) != "" {
+				format = "terminal_color"
+			} else {
+				format = "json"
+			}
+		}
+		if _, err := MakeFormatter(format); err != nil {
+			return nil, fmt.Errorf("stream sink format: %w", err)
+		}
+
+		sinks = append(sinks, sink{"stream", HandlerConf{"stream", "stderr", format}})
+	}
+	if opts.Extra != nil {
+		sinks = append(sinks, sink{"extra", opts.Extra})
+	}
+
+	var hs []log15.Handler
+	for _, s := range sinks {
+		h, err := MakeHandler(s.conf)
+		if err != nil {
+			for _, h := range hs {
+				closeHandler(h)
+			}
+			return nil, fmt.Errorf("%s sink: %w", s.name, err)
+		}
+		hs = append(hs, h)
 	}
-	return MakeHandler(finalHandlerConf)
+
+	children := make([]interface{}, len(hs))
+	for i, h := range hs {
+		children[i] = h
+	}
+	return withChildren(log15.LvlFilterHandler(lvl, log15.CallerFileHandler(log15.MultiHandler(hs...))), children...), nil
 }
 
 // MakeNoopHandler prepares a log handler that discards all the log
@@ -540,3 +2900,23 @@ func MakeBasicHandler(fpath, lvl string, quiet bool) (Handler, error) {
 func MakeNoopHandler() (Handler, error) {
 	return MakeHandler(HandlerConf{"discard"})
 }
+
+// MustMakeHandler is like MakeHandler but panics if @conf is bad.
+// It is meant for init-time configuration known to be good, along
+// the lines of regexp.MustCompile.
+func MustMakeHandler(conf HandlerConf) Handler {
+	h, err := MakeHandler(conf)
+	if err != nil {
+		panic(fmt.Sprintf("log: MakeHandler(%v): %v", conf, err))
+	}
+	return h
+}
+
+// MustMakeFormatter is like MakeFormatter but panics if @format is bad
+func MustMakeFormatter(format FormatConf) Format {
+	f, err := MakeFormatter(format)
+	if err != nil {
+		panic(fmt.Sprintf("log: MakeFormatter(%v): %v", format, err))
+	}
+	return f
+}
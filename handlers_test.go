@@ -0,0 +1,304 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// wrongType is a value no handler or format argument accepts
+type wrongType struct{}
+
+var discard = HandlerConf{"discard"}
+
+// confArgs returns valid args for every built-in handler, pointing files
+// into @dir and network sinks at a closed port. They are only used with
+// one of them replaced by a wrongType, so nothing gets opened or dialled.
+func confArgs(dir string) map[string][]interface{} {
+	path := filepath.Join(dir, "log")
+	addr := "127.0.0.1:1"
+
+	return map[string][]interface{}{
+		"async":                   {10, "block", discard},
+		"buffered":                {10, discard},
+		"caller_file":             {discard},
+		"caller_func":             {discard},
+		"caller_pkg":              {discard},
+		"caller_stack":            {"%+v", discard},
+		"caller_stack_structured": {5, discard},
+		"cloudwatch":              {"group", "stream", "us-east-1", "json"},
+		"dedup":                   {"1s", discard},
+		"delayed_sample":          {100, 0.5, discard},
+		"dict_compress":           {[]string{"k"}, 1000, discard},
+		"discard":                 {},
+		"drop_fields":             {[]string{"k"}, discard},
+		"dual_format":             {"logfmt", "json", "stderr", true, "\n"},
+		"error_caller":            {discard},
+		"error_stack":             {discard},
+		"escalate_repeat":         {3, 1000, "error", "crit", discard},
+		"failover":                {discard, discard},
+		"file":                    {path, "json"},
+		"file_sync":               {path, "json", 10},
+		"geoip":                   {filepath.Join(dir, "geo.mmdb"), "ip", discard},
+		"goroutine_ctx":           {discard},
+		"http":                    {"http://" + addr + "/", "json"},
+		"kafka":                   {addr, "logs", "json", "topic"},
+		"lazy":                    {discard},
+		"level_filter":            {"info", discard},
+		"level_from_field":        {"severity", discard},
+		"level_route":             {"error", discard, "info", discard},
+		"level_router":            {map[string]HandlerConf{"error": discard}},
+		"level_sample":            {map[string]float64{"info": 0.5}, discard},
+		"logstash":                {addr, "json"},
+		"match_all":               {"k", "v", "n", 1, discard},
+		"match_any":               {"k", "v", "n", 1, discard},
+		"match_filter":            {"k", "v", discard},
+		"max_depth":               {3, discard},
+		"metrics":                 {discard},
+		"monotonic":               {discard},
+		"multi":                   {0, discard, 10, discard},
+		"net":                     {"tcp", addr, "json"},
+		"net_reconnect":           {"tcp", addr, "json"},
+		"not_match_filter":        {"k", "v", discard},
+		"project_fields":          {[]string{"k"}, discard},
+		"rate_limit":              {10, discard},
+		"redact":                  {[]string{"password"}, "***", discard},
+		"redact_pattern":          {[]string{"email"}, "***", discard},
+		"redact_patterns":         {[]string{"email"}, "***", discard},
+		"redis":                   {addr, "logs", "list", 100, "alive", 10, RedisOptions{}},
+		"redis_multi":             {[]string{addr}, "logs"},
+		"redis_tls":               {addr, "logs", "list", 100, "alive", 10, RedisOptions{}},
+		"request_buffer":          {true, discard},
+		"ring":                    {10, "json", discard},
+		"rotating_file":           {path, "json", 1000, 3, true, "24h"},
+		"safe":                    {discard, discard},
+		"sample":                  {0.5, discard},
+		"sentry":                  {"https://key@" + addr + "/1", "warn", discard},
+		"span_timer":              {1000, discard},
+		"stats":                   {discard},
+		"stream":                  {"stderr", "json"},
+		"swappable":               {discard},
+		"sync":                    {discard},
+		"syslog":                  {"tag", "json", "local0"},
+		"syslog_net":              {"udp", addr, "tag", "json", "local0"},
+		"timed_rotating_file":     {path, "json", "1h", true},
+		"tty_stream":              {"stderr", 1000},
+		"unique_id":               {discard},
+	}
+}
+
+// formatArgs holds valid args for every built-in format taking any
+var formatArgs = map[string][]interface{}{
+	"csv":            {[]string{"msg"}, true},
+	"gelf":           {"host"},
+	"json":           {JSONOptions{}, RecordKeyNames{}},
+	"json_flat":      {3},
+	"json_pretty":    {JSONOptions{}, RecordKeyNames{}},
+	"logfmt":         {"2006-01-02", RecordKeyNames{}},
+	"otel_json":      {map[string]string{"service.name": "test"}},
+	"syslog_rfc5424": {"app"},
+	"terminal":       {map[string]string{"info": "32"}, "15:04:05"},
+	"terminal_color": {map[string]string{"info": "32"}, "15:04:05"},
+}
+
+// build calls @mk with @conf, turning a panic into a test failure
+func build(t *testing.T, conf HandlerConf, mk func(HandlerConf) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("%v: panicked: %v", conf, r)
+			err = BadConf
+		}
+	}()
+	return mk(conf)
+}
+
+func makeHandlerErr(conf HandlerConf) error {
+	h, err := MakeHandler(conf)
+	if err == nil {
+		closeHandler(h)
+	}
+	return err
+}
+
+func makeFormatterErr(conf HandlerConf) error {
+	_, err := MakeFormatter(conf)
+	return err
+}
+
+// TestWrongArgTypes gives every built-in handler and format a value of
+// the wrong type at each argument position, and as each of 1 to 6 args
+func TestWrongArgTypes(t *testing.T) {
+	handlers := confArgs(t.TempDir())
+	for name := range builtinHandlers {
+		if _, ok := handlers[name]; !ok {
+			t.Errorf("handler %q: no args to test with", name)
+		}
+	}
+
+	check := func(kind string, table map[string]bool, args map[string][]interface{}, mk func(HandlerConf) error) {
+		names := make([]string, 0, len(table))
+		for name := range table {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			valid := args[name]
+			for i := range valid {
+				conf := append(HandlerConf{name}, valid...)
+				conf[i+1] = wrongType{}
+
+				if err := build(t, conf, mk); !errors.Is(err, BadConf) {
+					t.Errorf("%s %q arg %d: expected BadConf, got %v", kind, name, i, err)
+				}
+			}
+
+			for n := 1; n <= 6; n++ {
+				conf := HandlerConf{name}
+				for i := 0; i < n; i++ {
+					conf = append(conf, wrongType{})
+				}
+
+				if err := build(t, conf, mk); !errors.Is(err, BadConf) {
+					t.Errorf("%s %q with %d wrong args: expected BadConf, got %v", kind, name, n, err)
+				}
+			}
+		}
+	}
+
+	check("handler", builtinHandlers, handlers, makeHandlerErr)
+	check("format", builtinFormatters, formatArgs, makeFormatterErr)
+}
+
+// TestWrongNestedConf checks that a bad child conf fails its parent with
+// BadConf rather than panicking
+func TestWrongNestedConf(t *testing.T) {
+	for _, child := range []interface{}{HandlerConf{}, HandlerConf{wrongType{}}, HandlerConf{"no_such_handler"}} {
+		conf := HandlerConf{"multi", child}
+		if err := build(t, conf, makeHandlerErr); !errors.Is(err, BadConf) {
+			t.Errorf("%v: expected BadConf, got %v", fmt.Sprint(conf), err)
+		}
+	}
+}
+
+// TestFailoverUsesFirstHandler checks that failover logs to its first
+// child while it works, not to leading nil handlers
+func TestFailoverUsesFirstHandler(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first"), filepath.Join(dir, "second")
+
+	h, err := MakeHandler(HandlerConf{"failover",
+		HandlerConf{"file", first, "logfmt"},
+		HandlerConf{"file", second, "logfmt"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeHandler(h)
+
+	l := log15.New()
+	l.SetHandler(h)
+	l.Info("hello")
+
+	if b, _ := os.ReadFile(first); !strings.Contains(string(b), "msg=hello") {
+		t.Errorf("first handler: expected the record, got %q", b)
+	}
+	if b, _ := os.ReadFile(second); len(b) != 0 {
+		t.Errorf("second handler: expected nothing, got %q", b)
+	}
+}
+
+// openFilesIn returns the files under @dir this process has open
+func openFilesIn(t *testing.T, dir string) []string {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("no /proc/self/fd to list open files with")
+	}
+
+	var res []string
+	for _, fd := range fds {
+		path, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+		if err == nil && strings.HasPrefix(path, dir) {
+			res = append(res, path)
+		}
+	}
+	return res
+}
+
+// TestBuildErrorClosesChildren checks that when building a handler fails
+// part way, the files opened by the children built so far are closed
+func TestBuildErrorClosesChildren(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) HandlerConf {
+		return HandlerConf{"file", filepath.Join(dir, name), "json"}
+	}
+	bad := HandlerConf{"file", filepath.Join(dir, "missing", "log"), "json"}
+
+	for _, conf := range []HandlerConf{
+		{"multi", file("a"), HandlerConf{"caller_file", file("b")}, bad},
+		{"multi", 0, file("a"), 10, HandlerConf{"async", 10, "block", file("b")}, bad},
+		{"failover", HandlerConf{"level_filter", "info", file("a")}, bad},
+		{"level_route", "error", file("a"), "info", bad},
+		{"level_route", "error", file("a"), "nope", file("b")},
+		{"level_router", map[string]HandlerConf{"error": file("a"), "warn": file("b"), "info": bad}},
+		{"level_router", map[string]HandlerConf{"error": file("a"), "warn": file("b"), "nope": file("c")}},
+		{"geoip", filepath.Join(dir, "missing.mmdb"), "ip", file("a")},
+		{"safe", HandlerConf{"sync", file("a")}, bad},
+		{"safe", file("a"), wrongType{}},
+		{"sentry", "not a dsn", HandlerConf{"buffered", 10, file("a")}},
+		{"ring", 0, file("a")},
+	} {
+		if _, err := MakeHandler(conf); err == nil {
+			t.Errorf("%v: expected an error", conf)
+		}
+
+		if open := openFilesIn(t, dir); len(open) != 0 {
+			t.Errorf("%v: left open %v", conf, open)
+		}
+	}
+}
+
+// TestBasicHandlerBadConf checks that every bad option of
+// MakeBasicHandlerOpts is reported as BadConf
+func TestBasicHandlerBadConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+
+	for _, opts := range []BasicOptions{
+		{Level: "verbose", Quiet: true},
+		{Level: "", Quiet: true},
+		{Path: path, Level: "info", FileFormat: "yaml", Quiet: true},
+		{Level: "info", StreamFormat: wrongType{}},
+		{Level: "info", Quiet: true, Extra: HandlerConf{"no_such_handler"}},
+	} {
+		h, err := MakeBasicHandlerOpts(opts)
+		if err == nil {
+			closeHandler(h)
+		}
+		if !errors.Is(err, BadConf) {
+			t.Errorf("%+v: expected BadConf, got %v", opts, err)
+		}
+	}
+}
+
+// TestBadValueErrors checks that bad values are reported against the
+// handler and the position of the arg holding them
+func TestBadValueErrors(t *testing.T) {
+	for _, c := range []struct {
+		conf HandlerConf
+		want string
+	}{
+		{HandlerConf{"ring", 0, discard}, `handler "ring" arg 0: expected a size of at least 1, got 0`},
+		{HandlerConf{"level_sample", map[string]float64{"info": 2}, discard}, `handler "level_sample" arg 0: expected a rate between 0 and 1 for info, got 2`},
+		{HandlerConf{"level_sample", map[string]float64{"verbose": 0.5}, discard}, `handler "level_sample" arg 0: expected rates keyed by level name, got verbose`},
+	} {
+		err := build(t, c.conf, makeHandlerErr)
+		if !errors.Is(err, BadConf) || err == nil || !strings.HasSuffix(err.Error(), c.want) {
+			t.Errorf("%v: expected BadConf ending with %q, got %v", c.conf, c.want, err)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPFlushInterval is how often an HTTPHandler sends the records
+// gathered since its last send
+var HTTPFlushInterval = time.Second
+
+// HTTPMaxBatch caps the number of records sent in one request. Set it
+// to 1 for endpoints that take a single message per request (eg: Slack
+// style webhooks).
+var HTTPMaxBatch = 100
+
+// HTTPBufferSize is the number of records an HTTPHandler holds between
+// sends. When it is full the oldest are dropped.
+var HTTPBufferSize = 10000
+
+// HTTPRetries is the number of times a request that fails to be sent or
+// is answered with a 5xx status is retried, waiting twice as long before
+// each retry starting from HTTPRetryBackoff
+var (
+	HTTPRetries      = 3
+	HTTPRetryBackoff = 200 * time.Millisecond
+)
+
+// HTTPHandler POSTs formatted records to a URL such as a webhook.
+// Records are gathered and sent every HTTPFlushInterval, up to
+// HTTPMaxBatch of them per request with their formatted forms
+// concatenated as the body. With an application/json ContentType and
+// HTTPMaxBatch above 1, the body is a JSON array of the records instead,
+// so that it stays valid JSON. Up to HTTPBufferSize records are held
+// between sends. Records dropped because the buffer was full or that
+// can't be delivered are counted (see Dropped).
+type HTTPHandler struct {
+	URL         string
+	ContentType string
+
+	fmtr    Format
+	client  *http.Client
+	mu      sync.Mutex
+	pending [][]byte
+	dropped uint64
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// MakeHTTPHandler prepares a handler posting records formatted with
+// @fmtr to @rawurl with the given @contentType. The endpoint's host is
+// dialled once so that an unreachable endpoint is reported right away.
+func MakeHTTPHandler(rawurl string, contentType string, fmtr Format) (*HTTPHandler, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: bad http url %q", BadConf, rawurl)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+
+	p := &HTTPHandler{
+		URL:         rawurl,
+		ContentType: contentType,
+		fmtr:        fmtr,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		done:        make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.flushPeriodically(p.done)
+
+	return p, nil
+}
+
+func (p *HTTPHandler) Log(r *log15.Record) error {
+	b := p.fmtr.Format(r)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done == nil {
+		atomic.AddUint64(&p.dropped, 1)
+		return nil
+	}
+
+	max := HTTPBufferSize
+	if max < 1 {
+		max = 1
+	}
+	if n := len(p.pending) - max + 1; n > 0 {
+		// full; drop the oldest records to make room
+		p.pending = p.pending[n:]
+		atomic.AddUint64(&p.dropped, uint64(n))
+	}
+
+	p.pending = append(p.pending, b)
+	return nil
+}
+
+func (p *HTTPHandler) flushPeriodically(done chan struct{}) {
+	defer p.wg.Done()
+
+	t := time.NewTicker(HTTPFlushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			p.flush()
+			return
+		case <-t.C:
+			p.flush()
+		}
+	}
+}
+
+// flush sends all pending records
+func (p *HTTPHandler) flush() {
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+
+	max := HTTPMaxBatch
+	if max < 1 {
+		max = 1
+	}
+
+	for len(pending) > 0 {
+		n := len(pending)
+		if n > max {
+			n = max
+		}
+
+		body := bytes.Join(pending[:n], nil)
+		if max > 1 && p.ContentType == "application/json" {
+			body = jsonArray(pending[:n])
+		}
+
+		if err := p.post(body); err != nil {
+			atomic.AddUint64(&p.dropped, uint64(n))
+		}
+		pending = pending[n:]
+	}
+}
+
+// jsonArray joins the json documents @docs into a JSON array
+func jsonArray(docs [][]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, d := range docs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(bytes.TrimSpace(d))
+	}
+	buf.WriteString("]\n")
+	return buf.Bytes()
+}
+
+// post sends @body, retrying when sending fails or on 5xx responses
+func (p *HTTPHandler) post(body []byte) error {
+	backoff := HTTPRetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := p.client.Post(p.URL, p.ContentType, bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+
+			switch {
+			case resp.StatusCode < 300:
+				return nil
+			case resp.StatusCode < 500:
+				return fmt.Errorf("log: %s: %s", p.URL, resp.Status)
+			}
+			err = fmt.Errorf("log: %s: %s", p.URL, resp.Status)
+		}
+
+		if attempt >= HTTPRetries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Dropped returns the number of records that could not be delivered
+func (p *HTTPHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close sends the pending records and stops the handler.
+// It is safe to call Close more than once.
+func (p *HTTPHandler) Close() error {
+	p.mu.Lock()
+	done := p.done
+	p.done = nil
+	p.mu.Unlock()
+
+	if done != nil {
+		close(done)
+		p.wg.Wait()
+	}
+	return nil
+}
+
+// contentType guesses the Content-Type of records in @format
+func contentType(format FormatConf) string {
+	name, _ := format.(string)
+	if conf, ok := format.(HandlerConf); ok && len(conf) > 0 {
+		name, _ = conf[0].(string)
+	}
+
+	switch name {
+	case "json", "json_pretty", "json_flat", "gelf", "otel_json", "stackdriver":
+		return "application/json"
+	case "csv":
+		return "text/csv"
+	case "msgpack":
+		return "application/msgpack"
+	}
+	return "text/plain; charset=utf-8"
+}
@@ -0,0 +1,125 @@
+package log
+
+import (
+	"encoding/json"
+	"gopkg.in/inconshreveable/log15.v2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// httpSink is a test endpoint recording the bodies POSTed to it. It
+// drops the connection of the first @fail requests without answering.
+type httpSink struct {
+	mu     sync.Mutex
+	fail   int
+	bodies []string
+	types  []string
+}
+
+func (p *httpSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.fail > 0 {
+		p.fail--
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	}
+
+	b, _ := io.ReadAll(r.Body)
+	p.bodies = append(p.bodies, string(b))
+	p.types = append(p.types, r.Header.Get("Content-Type"))
+}
+
+// startHTTPSink serves @sink and returns an http handler posting json
+// records to it, which is not flushed until closed
+func startHTTPSink(t *testing.T, sink *httpSink) *HTTPHandler {
+	srv := httptest.NewServer(sink)
+	t.Cleanup(srv.Close)
+
+	interval, backoff := HTTPFlushInterval, HTTPRetryBackoff
+	HTTPFlushInterval, HTTPRetryBackoff = time.Hour, time.Millisecond
+	t.Cleanup(func() { HTTPFlushInterval, HTTPRetryBackoff = interval, backoff })
+
+	h, err := MakeHandler(HandlerConf{"http", srv.URL, "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.(*HTTPHandler)
+}
+
+func logHTTP(h *HTTPHandler, msgs ...string) {
+	for _, msg := range msgs {
+		h.Log(&log15.Record{Time: time.Now(), Lvl: log15.LvlInfo, Msg: msg, KeyNames: log15.RecordKeyNames{
+			Time: "t", Lvl: "lvl", Msg: "msg",
+		}})
+	}
+}
+
+// httpMsgs decodes @body as a JSON array of records and returns their msgs
+func httpMsgs(t *testing.T, body string) []string {
+	var recs []map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &recs); err != nil {
+		t.Fatalf("expected a JSON array, got %q: %v", body, err)
+	}
+
+	var msgs []string
+	for _, r := range recs {
+		msgs = append(msgs, r["msg"].(string))
+	}
+	return msgs
+}
+
+// TestHTTPJSONBatch checks that a batch of json records is sent as one
+// valid JSON document
+func TestHTTPJSONBatch(t *testing.T) {
+	sink := &httpSink{}
+	h := startHTTPSink(t, sink)
+	logHTTP(h, "a", "b", "c")
+	h.Close()
+
+	if len(sink.bodies) != 1 || sink.types[0] != "application/json" {
+		t.Fatalf("expected 1 application/json request, got %q", sink.types)
+	}
+	if msgs := httpMsgs(t, sink.bodies[0]); len(msgs) != 3 || msgs[0] != "a" || msgs[2] != "c" {
+		t.Errorf("expected records a, b and c, got %v", msgs)
+	}
+}
+
+// TestHTTPBufferFull checks that a full buffer drops and counts its
+// oldest records
+func TestHTTPBufferFull(t *testing.T) {
+	size := HTTPBufferSize
+	HTTPBufferSize = 2
+	defer func() { HTTPBufferSize = size }()
+
+	sink := &httpSink{}
+	h := startHTTPSink(t, sink)
+	logHTTP(h, "a", "b", "c")
+	h.Close()
+
+	if n := h.Dropped(); n != 1 {
+		t.Errorf("expected 1 dropped record, got %d", n)
+	}
+	if msgs := httpMsgs(t, sink.bodies[0]); len(msgs) != 2 || msgs[0] != "b" || msgs[1] != "c" {
+		t.Errorf("expected records b and c, got %v", msgs)
+	}
+}
+
+// TestHTTPRetryDroppedConnection checks that a request whose connection
+// is dropped is retried
+func TestHTTPRetryDroppedConnection(t *testing.T) {
+	sink := &httpSink{fail: 2}
+	h := startHTTPSink(t, sink)
+	logHTTP(h, "a")
+	h.Close()
+
+	if n := h.Dropped(); n != 0 || len(sink.bodies) != 1 {
+		t.Errorf("expected the record delivered on a retry, got %d dropped and %d requests", n, len(sink.bodies))
+	}
+}
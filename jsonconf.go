@@ -0,0 +1,39 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// MakeHandlerFromJSON reads a handler conf written as JSON from @r and
+// builds it with MakeHandler, eg:
+//	["level_filter", "info", ["multi",
+//		["file", "/tmp/test.log", "json"],
+//		["buffered", 100, ["stream", "stderr", ["terminal", {"info": "2"}]]]]]
+// JSON values map to the Go values MakeHandler expects as follows:
+//	- arrays become HandlerConf, except that an array of strings given as
+//	  the first argument of a handler or format becomes []string when its
+//	  first element isn't a handler or format name (eg: the columns of
+//	  "csv" or the keys of "drop_fields")
+//	- integer literals become int, other numbers float64; so a float
+//	  argument has to be written with a fraction, eg: 1.0 not 1
+//	- objects become map[string]string, map[string]float64 or
+//	  map[string]HandlerConf when all their values are strings, numbers
+//	  or arrays respectively, and map[string]interface{} otherwise
+// Errors name the offending node by its position, eg: $[2][1][0]
+func MakeHandlerFromJSON(r io.Reader) (Handler, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("log: json conf: %v", err)
+	}
+
+	h, err := makeHandlerFromValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("log: json conf: %w", err)
+	}
+	return h, nil
+}
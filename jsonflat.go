@@ -0,0 +1,89 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"gopkg.in/inconshreveable/log15.v2"
+	"strconv"
+)
+
+// JSONFlatDepth is the number of levels of nesting JSONFlatFormat
+// flattens when not told otherwise
+const JSONFlatDepth = 8
+
+// JSONFlatFormat is log15's json format with objects and arrays in ctx
+// values flattened into top level fields, for indexers that only handle
+// those. Keys are joined with dots and array elements are keyed by their
+// index, eg: "user": {"id": 3, "tags": ["a"]} is logged as "user.id": 3
+// and "user.tags.0": "a". Values nested more than @maxDepth levels deep
+// are kept JSON encoded, as a string, under the key reached at that
+// depth. @maxDepth <= 0 means JSONFlatDepth.
+func JSONFlatFormat(maxDepth int) Format {
+	if maxDepth <= 0 {
+		maxDepth = JSONFlatDepth
+	}
+
+	f := log15.JsonFormatEx(false, true)
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		b := f.Format(r)
+
+		var m map[string]interface{}
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		if err := d.Decode(&m); err != nil {
+			return b
+		}
+
+		flat := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			flattenJSON(flat, k, v, maxDepth)
+		}
+
+		fb, err := json.Marshal(flat)
+		if err != nil {
+			return b
+		}
+		return append(fb, '\n')
+	})
+}
+
+// flattenJSON sets @v in @dst at @key, or its elements at dotted keys
+// under @key if it is a non empty object or array, down to @depth levels
+func flattenJSON(dst map[string]interface{}, key string, v interface{}, depth int) {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		if len(c) == 0 {
+			break
+		}
+		if depth == 0 {
+			v = jsonString(v)
+			break
+		}
+
+		for k, e := range c {
+			flattenJSON(dst, key+"."+k, e, depth-1)
+		}
+		return
+
+	case []interface{}:
+		if len(c) == 0 {
+			break
+		}
+		if depth == 0 {
+			v = jsonString(v)
+			break
+		}
+
+		for i, e := range c {
+			flattenJSON(dst, key+"."+strconv.Itoa(i), e, depth-1)
+		}
+		return
+	}
+
+	dst[key] = v
+}
+
+func jsonString(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
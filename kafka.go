@@ -0,0 +1,192 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KafkaBufferSize is the number of formatted records a KafkaHandler
+// holds for the producer before it starts dropping the oldest ones
+var KafkaBufferSize = 10000
+
+// KafkaBatchSize caps the number of records sent to Kafka in one request
+var KafkaBatchSize = 100
+
+// KafkaWriteTimeout bounds each produce request so that an unreachable
+// cluster doesn't stall the producer forever
+var KafkaWriteTimeout = 10 * time.Second
+
+// kafkaMaxTopic is the longest topic name Kafka accepts
+const kafkaMaxTopic = 249
+
+// KafkaHandler produces formatted records to a Kafka topic, or to one
+// topic per level. Records are handed to a background producer through a
+// buffered channel so that logging never waits on the brokers. When the
+// buffer is full the oldest record is dropped to make room and counted
+// (see Dropped), as are records that fail to be produced.
+type KafkaHandler struct {
+	Brokers []string
+	Topic   string // when producing to a single topic
+	// when routing by level, records go to TopicPrefix + the level's
+	// name, eg: "logs." + "error"
+	TopicPrefix string
+
+	fmtr    Format
+	w       *kafka.Writer
+	mu      sync.RWMutex
+	msgs    chan kafka.Message
+	closed  bool
+	dropped uint64
+	wg      sync.WaitGroup
+}
+
+// MakeKafkaHandler prepares a handler producing records formatted with
+// @fmtr to @topic on the cluster reachable at @brokers ("host:port")
+// and starts its producer
+func MakeKafkaHandler(brokers []string, topic string, fmtr Format) (*KafkaHandler, error) {
+	if len(brokers) == 0 || topic == "" {
+		return nil, fmt.Errorf("%w: kafka: expected brokers and a topic", BadConf)
+	}
+
+	return makeKafkaHandler(brokers, topic, "", fmtr), nil
+}
+
+// MakeKafkaLevelHandler is MakeKafkaHandler producing each record to the
+// topic @topicPrefix + the name of its level (crit, error, warn, info or
+// debug), eg: "logs." routes errors to "logs.error" so that alerting can
+// consume them alone. Records are batched per topic. A prefix that
+// doesn't make valid topic names is BadConf.
+func MakeKafkaLevelHandler(brokers []string, topicPrefix string, fmtr Format) (*KafkaHandler, error) {
+	if len(brokers) == 0 || topicPrefix == "" {
+		return nil, fmt.Errorf("%w: kafka: expected brokers and a topic prefix", BadConf)
+	}
+
+	for _, c := range topicPrefix {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return nil, fmt.Errorf("%w: kafka: topic prefix %q: topics only allow ASCII letters, digits, '.', '_' and '-'", BadConf, topicPrefix)
+		}
+	}
+	if len(topicPrefix)+len("debug") > kafkaMaxTopic {
+		return nil, fmt.Errorf("%w: kafka: topic prefix %q: topics are at most %d long", BadConf, topicPrefix, kafkaMaxTopic)
+	}
+
+	return makeKafkaHandler(brokers, "", topicPrefix, fmtr), nil
+}
+
+// makeKafkaHandler prepares a handler producing to @topic or, if empty,
+// routing by level to @topicPrefix topics, and starts its producer
+func makeKafkaHandler(brokers []string, topic, topicPrefix string, fmtr Format) *KafkaHandler {
+	bufSize := KafkaBufferSize
+	if bufSize < 1 {
+		bufSize = 1
+	}
+
+	p := &KafkaHandler{
+		Brokers:     brokers,
+		Topic:       topic,
+		TopicPrefix: topicPrefix,
+		fmtr:        fmtr,
+		// the writer batches messages per topic when they carry their own
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.LeastBytes{},
+			BatchSize:    KafkaBatchSize,
+			BatchTimeout: 10 * time.Millisecond,
+		},
+		msgs: make(chan kafka.Message, bufSize),
+	}
+
+	p.wg.Add(1)
+	go p.produce()
+
+	return p
+}
+
+func (p *KafkaHandler) Log(r *log15.Record) error {
+	m := kafka.Message{Value: p.fmtr.Format(r)}
+	if p.Topic == "" {
+		m.Topic = p.TopicPrefix + lvlName(Lvl(r.Lvl))
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		atomic.AddUint64(&p.dropped, 1)
+		return nil
+	}
+
+	for {
+		select {
+		case p.msgs <- m:
+			return nil
+		default:
+		}
+
+		// full; drop the oldest record to make room
+		select {
+		case <-p.msgs:
+			atomic.AddUint64(&p.dropped, 1)
+		default:
+		}
+	}
+}
+
+// produce sends buffered records to Kafka in batches
+// until the handler is closed and the buffer drained
+func (p *KafkaHandler) produce() {
+	defer p.wg.Done()
+
+	batch := make([]kafka.Message, 0, KafkaBatchSize)
+	for m := range p.msgs {
+		batch = append(batch[:0], m)
+
+	fill:
+		for len(batch) < KafkaBatchSize {
+			select {
+			case m, ok := <-p.msgs:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, m)
+			default:
+				break fill
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), KafkaWriteTimeout)
+		if err := p.w.WriteMessages(ctx, batch...); err != nil {
+			atomic.AddUint64(&p.dropped, uint64(len(batch)))
+		}
+		cancel()
+	}
+}
+
+// Dropped returns the number of records that were discarded because
+// the buffer was full, the handler was closed or producing failed
+func (p *KafkaHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close stops accepting records, waits for the buffered ones to be
+// produced and closes the connection to the brokers. It is safe to
+// call Close more than once.
+func (p *KafkaHandler) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.msgs)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return p.w.Close()
+}
@@ -0,0 +1,56 @@
+package log
+
+import (
+	"errors"
+	"github.com/segmentio/kafka-go"
+	"gopkg.in/inconshreveable/log15.v2"
+	"strings"
+	"testing"
+)
+
+func TestKafkaLevelTopicPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "logs/", "logs ", "lögs.", strings.Repeat("a", 245)} {
+		_, err := MakeKafkaLevelHandler([]string{"127.0.0.1:9092"}, prefix, JSONFormat(false, JSONOptions{}))
+		if !errors.Is(err, BadConf) {
+			t.Errorf("prefix %q: expected BadConf, got %v", prefix, err)
+		}
+	}
+
+	h, err := MakeHandler(HandlerConf{"kafka", "127.0.0.1:9092", "logs.", "json", "level"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeHandler(h)
+
+	if p := h.(*KafkaHandler); p.Topic != "" || p.TopicPrefix != "logs." {
+		t.Errorf("expected level routing to logs., got topic %q, prefix %q", p.Topic, p.TopicPrefix)
+	}
+
+	_, err = MakeHandler(HandlerConf{"kafka", "127.0.0.1:9092", "logs", "json", "partition"})
+	if !errors.Is(err, BadConf) {
+		t.Errorf("route partition: expected BadConf, got %v", err)
+	}
+}
+
+// TestKafkaDropOldest checks that a full buffer drops its oldest record
+// to make room for the new one, and counts it
+func TestKafkaDropOldest(t *testing.T) {
+	p := &KafkaHandler{
+		Topic: "logs",
+		fmtr:  log15.LogfmtFormat(),
+		msgs:  make(chan kafka.Message, 2),
+	}
+
+	for _, msg := range []string{"first", "second", "third"} {
+		p.Log(&log15.Record{Lvl: log15.LvlInfo, Msg: msg, KeyNames: log15.RecordKeyNames{Msg: "msg"}})
+	}
+
+	if n := p.Dropped(); n != 1 {
+		t.Errorf("expected 1 dropped record, got %d", n)
+	}
+	for _, want := range []string{"second", "third"} {
+		if m := <-p.msgs; !strings.Contains(string(m.Value), "msg="+want) {
+			t.Errorf("expected the %s record, got %q", want, m.Value)
+		}
+	}
+}
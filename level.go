@@ -0,0 +1,115 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"math"
+)
+
+// lvlNames are the full names of the levels, indexed by Lvl, where log15
+// abbreviates some (eg: "eror")
+var lvlNames = [...]string{"crit", "error", "warn", "info", "debug"}
+
+// lvlName returns the full name of @l, eg: "error"
+func lvlName(l Lvl) string {
+	if l < LvlCrit || int(l) >= len(lvlNames) {
+		return log15.Lvl(l).String()
+	}
+	return lvlNames[l]
+}
+
+// LvlFromAny returns the level @v stands for, either a name as understood
+// by log15.LvlFromString or a number from LvlCrit (0) to LvlDebug (4), eg:
+// from a generated config. Whole float64s such as JSON numbers are
+// accepted too. Anything else is BadConf.
+func LvlFromAny(v interface{}) (Lvl, error) {
+	switch v := v.(type) {
+	case string:
+		lvl, err := log15.LvlFromString(v)
+		if err != nil {
+			return 0, fmt.Errorf("%w: unknown level %q", BadConf, v)
+		}
+		return Lvl(lvl), nil
+
+	case int:
+		if v < int(LvlCrit) || v > int(LvlDebug) {
+			return 0, fmt.Errorf("%w: level %d out of range [%d, %d]", BadConf, v, LvlCrit, LvlDebug)
+		}
+		return Lvl(v), nil
+
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("%w: level %v is not a whole number", BadConf, v)
+		}
+		return LvlFromAny(int(v))
+	}
+
+	return 0, fmt.Errorf("%w: expected a level string or int, got %T", BadConf, v)
+}
+
+// LevelFromFieldHandler returns a handler that sets the level of each
+// record from the value of its @key ctx field (eg: an upstream system's
+// "severity") as understood by log15.LvlFromString, before passing it on
+// to @h. Records where the field is missing or not a known level keep
+// their level.
+func LevelFromFieldHandler(key string, h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if r.Ctx[i] != key {
+				continue
+			}
+
+			s, ok := r.Ctx[i+1].(string)
+			if !ok {
+				break
+			}
+
+			lvl, err := log15.LvlFromString(s)
+			if err != nil {
+				break
+			}
+
+			rc := *r
+			rc.Lvl = lvl
+			return h.Log(&rc)
+		}
+
+		return h.Log(r)
+	})
+}
+
+// LevelRouterHandler returns a handler that sends each record to the
+// handler routed for its level in @routes. Records of levels that have
+// no route are dropped.
+func LevelRouterHandler(routes map[Lvl]Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		h, ok := routes[Lvl(r.Lvl)]
+		if !ok {
+			return nil
+		}
+		return h.Log(r)
+	})
+}
+
+// LevelRoute is a branch of a LevelRouteHandler: records at MinLvl
+// or more severe go to Handler
+type LevelRoute struct {
+	MinLvl  Lvl
+	Handler Handler
+}
+
+// LevelRouteHandler returns a handler that sends each record to every
+// route whose MinLvl it is at or above, eg: with routes for debug and
+// warn a crit record goes to both and a debug record only to the first.
+// The same record is passed to all of them.
+func LevelRouteHandler(routes []LevelRoute) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		for _, route := range routes {
+			// more severe levels are lower
+			if Lvl(r.Lvl) <= route.MinLvl {
+				route.Handler.Log(r)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLevelRoute checks that a record goes to every branch whose min
+// level it is at or above, and only those
+func TestLevelRoute(t *testing.T) {
+	var got []string
+	branch := func(name string) Handler {
+		return log15.FuncHandler(func(r *log15.Record) error {
+			got = append(got, name)
+			return nil
+		})
+	}
+
+	h := LevelRouteHandler([]LevelRoute{
+		{MinLvl: LvlDebug, Handler: branch("debug")},
+		{MinLvl: LvlInfo, Handler: branch("info")},
+		{MinLvl: LvlWarn, Handler: branch("warn")},
+		{MinLvl: LvlError, Handler: branch("error")},
+		{MinLvl: LvlCrit, Handler: branch("crit")},
+	})
+
+	for _, c := range []struct {
+		lvl  Lvl
+		want string
+	}{
+		{LvlCrit, "debug info warn error crit"},
+		{LvlError, "debug info warn error"},
+		{LvlWarn, "debug info warn"},
+		{LvlInfo, "debug info"},
+		{LvlDebug, "debug"},
+	} {
+		got = nil
+		h.Log(&log15.Record{Lvl: log15.Lvl(c.lvl), Msg: "hello"})
+
+		if s := strings.Join(got, " "); s != c.want {
+			t.Errorf("%s: expected branches %q, got %q", lvlName(c.lvl), c.want, s)
+		}
+	}
+}
+
+// TestLevelRouteConf checks the "level_route" handler built from a conf
+// sends crit to both of its files and debug only to the debug one
+func TestLevelRouteConf(t *testing.T) {
+	dir := t.TempDir()
+	all, alerts := filepath.Join(dir, "all"), filepath.Join(dir, "alerts")
+
+	h, err := MakeHandler(HandlerConf{"level_route",
+		"debug", HandlerConf{"file", all, "logfmt"},
+		"warn", HandlerConf{"file", alerts, "logfmt"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeHandler(h)
+
+	l := log15.New()
+	l.SetHandler(h)
+	l.Debug("details")
+	l.Crit("down")
+
+	if b, _ := os.ReadFile(all); !strings.Contains(string(b), "msg=details") || !strings.Contains(string(b), "msg=down") {
+		t.Errorf("debug branch: expected both records, got %q", b)
+	}
+	if b, _ := os.ReadFile(alerts); strings.Contains(string(b), "msg=details") || !strings.Contains(string(b), "msg=down") {
+		t.Errorf("warn branch: expected only the crit record, got %q", b)
+	}
+}
@@ -6,8 +6,12 @@ package log
 
 import (
 	"fmt"
+	"github.com/go-stack/stack"
 	"gopkg.in/inconshreveable/log15.v2"
 	"log"
+	"os"
+	"strings"
+	"sync"
 )
 
 type Logger log15.Logger
@@ -19,6 +23,24 @@ type Lvl log15.Lvl
 type Record log15.Record
 type RecordKeyNames log15.RecordKeyNames
 
+// Pairs flattens the ctx into key/value pairs as taken by the
+// logging functions, eg: log.Info("msg", ctx.Pairs()...)
+func (c Ctx) Pairs() []interface{} {
+	pairs := make([]interface{}, 0, len(c)*2)
+	for k, v := range c {
+		pairs = append(pairs, k, v)
+	}
+	return pairs
+}
+
+const (
+	LvlCrit  = Lvl(log15.LvlCrit)
+	LvlError = Lvl(log15.LvlError)
+	LvlWarn  = Lvl(log15.LvlWarn)
+	LvlInfo  = Lvl(log15.LvlInfo)
+	LvlDebug = Lvl(log15.LvlDebug)
+)
+
 var New = log15.New
 var Root = log15.Root
 
@@ -28,6 +50,63 @@ var Error = log15.Error
 var Info = log15.Info
 var Warn = log15.Warn
 
+// With returns a child of @logger with @ctx added to its context.
+// Unlike calling logger.New directly, the result is this package's
+// Logger so chained construction needs no casts or log15 import.
+func With(logger Logger, ctx ...interface{}) Logger {
+	return logger.New(ctx...)
+}
+
+// Log logs @msg with @ctx through @logger at the level @lvl. The record's
+// call is the call to Log, as if the logger's method had been called.
+func Log(logger Logger, lvl Lvl, msg string, ctx ...interface{}) {
+	LogCall(logger, stack.Caller(1), lvl, msg, ctx...)
+}
+
+// LogCall is Log with the record's call set to @call, for helpers logging
+// on behalf of their caller so that the caller handlers report where the
+// helper was called rather than the helper, eg:
+//	log.LogCall(logger, stack.Caller(1), log.LvlInfo, "done")
+func LogCall(logger Logger, call stack.Call, lvl Lvl, msg string, ctx ...interface{}) {
+	// the logger's ctx can't be read, so log through a child having it
+	h := logger.GetHandler()
+	l := logger.New()
+	l.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		r.Call = call
+		return h.Log(r)
+	}))
+
+	switch lvl {
+	case LvlCrit:
+		l.Crit(msg, ctx...)
+	case LvlError:
+		l.Error(msg, ctx...)
+	case LvlWarn:
+		l.Warn(msg, ctx...)
+	case LvlInfo:
+		l.Info(msg, ctx...)
+	default:
+		l.Debug(msg, ctx...)
+	}
+}
+
+// WrapErrLogsNil makes WrapErr log its message even when the error is
+// nil. By default WrapErr does nothing for a nil error.
+var WrapErrLogsNil = false
+
+// WrapErr logs @msg at level @lvl with @err (under "err") and @ctx
+// attached and returns @err unchanged, so that logging and returning
+// an error is a single statement:
+//	return log.WrapErr(log.LvlError, "fetch failed", err, "url", url)
+func WrapErr(lvl Lvl, msg string, err error, ctx ...interface{}) error {
+	if err == nil && !WrapErrLogsNil {
+		return nil
+	}
+
+	LogCall(Root(), stack.Caller(1), lvl, msg, append([]interface{}{"err", err}, ctx...)...)
+	return err
+}
+
 func Printf(format string, v ...interface{}) {
 	Debug(fmt.Sprintf(format, v...))
 }
@@ -38,8 +117,56 @@ func Panicf(format string, v ...interface{}) {
 	panic(s)
 }
 
+// SetHandler makes the root logger, and so every logger derived from it,
+// log to @hdlr. It is safe to call while other goroutines are logging.
 func SetHandler(hdlr Handler) {
-	Root().SetHandler(hdlr)
+	SetHandlerAtomic(hdlr)
+}
+
+// the swappable handler installed on the root logger by the first
+// SetHandler, which later calls swap the handler of
+var rootSwap struct {
+	sync.Mutex
+	h *SwappableHandler
+}
+
+// SetHandlerAtomic is SetHandler returning the handler it replaces (nil
+// on the first call), which the caller may close once it is no longer
+// needed, eg: to reconfigure logging on SIGHUP:
+//	old := log.SetHandlerAtomic(hdlr)
+//	if c, ok := old.(io.Closer); ok {
+//		c.Close()
+//	}
+// The swap is atomic: every record goes either to the old handler or to
+// the new one. Records being handled by the old one may still be in
+// progress when it is returned. Calling Root().SetHandler directly
+// bypasses this and is not tracked.
+func SetHandlerAtomic(hdlr Handler) Handler {
+	rootSwap.Lock()
+	defer rootSwap.Unlock()
+
+	if rootSwap.h == nil {
+		rootSwap.h = MakeSwappableHandler(hdlr)
+		Root().SetHandler(rootSwap.h)
+		return nil
+	}
+
+	return rootSwap.h.Swap(hdlr)
+}
+
+// Configure builds a handler from @conf and makes the root logger log
+// to it, ie: it is MakeHandler and SetHandler in one call, eg:
+//	err := log.Configure(log.HandlerConf{"stream", "stderr", "json"})
+// On error logging is left as it was. The handler replaced is not closed,
+// the new one is closed by Close while it is installed.
+func Configure(conf HandlerConf) error {
+	h, err := MakeHandler(conf)
+	if err != nil {
+		return err
+	}
+
+	SetHandler(h)
+	return nil
 }
 
 type LogToLog15 struct {
@@ -50,10 +177,42 @@ func (p *LogToLog15) Write(b []byte) (n int, err error) {
 	return len(b), nil
 }
 
+// DefaultConfEnv names the environment variable that picks the handler
+// installed at package init, before main gets to configure logging.
+// Its value is either a preset or "<stream>:<format>":
+//	terminal	stderr in terminal format (the default)
+//	json		stderr in json format
+//	logfmt		stderr in logfmt format
+//	discard		drop everything
+//	stdout:json	any stream (stdout | stderr) and format accepted by MakeFormatter
+const DefaultConfEnv = "LOG_DEFAULT_CONF"
+
+// defaultHandlerConf maps the value of DefaultConfEnv to a handler conf
+func defaultHandlerConf(v string) HandlerConf {
+	switch v {
+	case "", "terminal", "json", "logfmt":
+		if v == "" {
+			v = "terminal"
+		}
+		return HandlerConf{"stream", "stderr", v}
+	case "discard":
+		return HandlerConf{"discard"}
+	}
+
+	if parts := strings.SplitN(v, ":", 2); len(parts) == 2 {
+		return HandlerConf{"stream", parts[0], parts[1]}
+	}
+
+	return nil
+}
+
 func init() {
 	// Route all logs sent to golang's built-in logger to us
 	log.SetOutput(&LogToLog15{})
 
-	hdlr, _ := MakeHandler(HandlerConf{"stream", "stderr", "terminal"})
+	hdlr, err := MakeHandler(defaultHandlerConf(os.Getenv(DefaultConfEnv)))
+	if err != nil {
+		hdlr, _ = MakeHandler(defaultHandlerConf(""))
+	}
 	SetHandler(hdlr)
 }
@@ -0,0 +1,125 @@
+package log
+
+import (
+	"errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countHandler counts the records it is given
+type countHandler struct {
+	n int64
+}
+
+func (p *countHandler) Log(r *log15.Record) error {
+	atomic.AddInt64(&p.n, 1)
+	return nil
+}
+
+// TestSetHandlerAtomicRace logs from many goroutines while swapping the
+// root handler, checking every record reaches exactly one handler. Run
+// with -race.
+func TestSetHandlerAtomicRace(t *testing.T) {
+	old := Root().GetHandler()
+	rootSwap.Lock()
+	oldSwap := rootSwap.h
+	rootSwap.h = nil
+	rootSwap.Unlock()
+	defer func() {
+		rootSwap.Lock()
+		rootSwap.h = oldSwap
+		rootSwap.Unlock()
+		Root().SetHandler(old)
+	}()
+
+	const loggers, records, swaps = 8, 500, 200
+
+	handlers := []*countHandler{{}}
+	if prev := SetHandlerAtomic(handlers[0]); prev != nil {
+		t.Fatalf("first call: expected no previous handler, got %v", prev)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < loggers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := New("logger", i)
+			for j := 0; j < records; j++ {
+				l.Info("hello", "n", j)
+			}
+		}(i)
+	}
+
+	for i := 0; i < swaps; i++ {
+		h := &countHandler{}
+		if prev := SetHandlerAtomic(h); prev != Handler(handlers[len(handlers)-1]) {
+			t.Fatalf("swap %d: expected the previous handler back", i)
+		}
+		handlers = append(handlers, h)
+	}
+	wg.Wait()
+
+	var total int64
+	for _, h := range handlers {
+		total += atomic.LoadInt64(&h.n)
+	}
+	if total != loggers*records {
+		t.Errorf("expected %d records handled, got %d", loggers*records, total)
+	}
+}
+
+// TestLogCall checks that Log attributes its records to its caller and
+// keeps the logger's ctx
+func TestLogCall(t *testing.T) {
+	var records []*log15.Record
+	l := New("svc", "api")
+	l.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	Log(l, LvlWarn, "slow", "ms", 900)
+	_, _, want, _ := runtime.Caller(0)
+	want--
+
+	if len(records) != 1 {
+		t.Fatalf("expected a record, got %d", len(records))
+	}
+	r := records[0]
+	if f := r.Call.Frame(); filepath.Base(f.File) != "log_test.go" || f.Line != want {
+		t.Errorf("expected the call at log_test.go:%d, got %s:%d", want, f.File, f.Line)
+	}
+	if r.Lvl != log15.LvlWarn || r.Msg != "slow" || len(r.Ctx) != 4 || r.Ctx[1] != "api" || r.Ctx[3] != 900 {
+		t.Errorf("expected a warning with the logger's ctx then its own, got %v %q %v", r.Lvl, r.Msg, r.Ctx)
+	}
+}
+
+// TestWrapErrCall checks that WrapErr attributes its records to its caller
+func TestWrapErrCall(t *testing.T) {
+	var records []*log15.Record
+	old := Root().GetHandler()
+	defer Root().SetHandler(old)
+	Root().SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	err := errors.New("timeout")
+	if WrapErr(LvlError, "fetch failed", err, "url", "/x") != err {
+		t.Error("expected the error back")
+	}
+	_, _, want, _ := runtime.Caller(0)
+	want -= 3
+
+	if len(records) != 1 {
+		t.Fatalf("expected a record, got %d", len(records))
+	}
+	if f := records[0].Call.Frame(); filepath.Base(f.File) != "log_test.go" || f.Line != want {
+		t.Errorf("expected the call at log_test.go:%d, got %s:%d", want, f.File, f.Line)
+	}
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"bytes"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net"
+	"time"
+)
+
+// LogstashBufferSize is the number of records a LogstashHandler holds
+// while it is (re)connecting. When it is full the oldest are dropped.
+var LogstashBufferSize = 1000
+
+// LogstashRetryBackoff is how long a LogstashHandler waits before its
+// first attempt to reconnect, doubling after each failed attempt up to
+// LogstashMaxBackoff
+var (
+	LogstashRetryBackoff = 200 * time.Millisecond
+	LogstashMaxBackoff   = 30 * time.Second
+)
+
+// LogstashHandler sends records to a Logstash tcp input using the
+// json_lines codec: each record is a JSON object on a line of its own,
+// terminated by a newline, whatever the format puts at its end. When the
+// connection is lost it reconnects with backoff, holding up to
+// LogstashBufferSize records meanwhile. Records dropped because the
+// buffer was full are counted (see Dropped).
+type LogstashHandler struct {
+	*NetReconnectHandler
+}
+
+// MakeLogstashHandler prepares a handler sending records formatted with
+// @fmtr (a json format) to the Logstash at @address. Logstash is dialled
+// once so that an unreachable address is reported right away.
+func MakeLogstashHandler(address string, fmtr Format) (*LogstashHandler, error) {
+	conn, err := net.DialTimeout("tcp", address, netTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := log15.FormatFunc(func(r *log15.Record) []byte {
+		return append(bytes.TrimRight(fmtr.Format(r), "\r\n"), '\n')
+	})
+
+	h, err := makeNetReconnectHandler("tcp", address, lines, conn,
+		LogstashBufferSize, LogstashRetryBackoff, LogstashMaxBackoff)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogstashHandler{h}, nil
+}
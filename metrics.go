@@ -0,0 +1,38 @@
+package log
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+// logRecords counts the records passing through the "metrics" handlers by
+// level name. Every level has a series from the start so that rates of
+// levels not yet logged are 0, not absent.
+var logRecords = func() *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "log_records_total",
+		Help: "Number of log records handled, by level.",
+	}, []string{"level"})
+
+	for i := LvlCrit; i <= LvlDebug; i++ {
+		c.WithLabelValues(log15.Lvl(i).String())
+	}
+	return c
+}()
+
+// MetricsCollector returns the Prometheus collector of the
+// log_records_total counter maintained by the "metrics" handlers, to be
+// registered with the registry of the application's choice, eg:
+//	prometheus.MustRegister(log.MetricsCollector())
+func MetricsCollector() prometheus.Collector {
+	return logRecords
+}
+
+// MetricsHandler returns a handler that counts the records passing through
+// it by level (see MetricsCollector) before passing them on to @h
+func MetricsHandler(h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		logRecords.WithLabelValues(r.Lvl.String()).Inc()
+		return h.Log(r)
+	})
+}
@@ -0,0 +1,39 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync/atomic"
+	"time"
+)
+
+// processStart anchors the monotonic clock readings of MonotonicHandler
+var processStart = time.Now()
+
+var lastMono int64
+
+// monoNow returns the nanoseconds elapsed since process start as per
+// the monotonic clock, bumped if needed so that it strictly increases
+func monoNow() int64 {
+	now := int64(time.Since(processStart))
+	for {
+		last := atomic.LoadInt64(&lastMono)
+		if now <= last {
+			now = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&lastMono, last, now) {
+			return now
+		}
+	}
+}
+
+// MonotonicHandler returns a handler that adds a "mono_ns" ctx field
+// holding a strictly increasing nanosecond reading of the monotonic
+// clock. Unlike wall clock time it never jumps backwards (eg: on NTP
+// adjustments) so it reliably orders records within a process. It is
+// only comparable between records of the same process lifetime.
+func MonotonicHandler(h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		r.Ctx = append(r.Ctx, "mono_ns", monoNow())
+		return h.Log(r)
+	})
+}
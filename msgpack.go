@@ -0,0 +1,228 @@
+package log
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"math"
+	"reflect"
+	"time"
+)
+
+// MsgpackFormat renders each record as a MessagePack map of the time (as
+// a msgpack timestamp), the level name, the message and the ctx fields,
+// ie: what the json format holds at a fraction of the encoding cost. Ctx
+// values that are not scalars, slices or maps are sent JSON encoded.
+//
+// The output is binary: meant for the kafka and redis handlers and files
+// read back by programs, not for "stream" or a terminal. Records are
+// self-delimiting so a file of them can be decoded one after another.
+func MsgpackFormat() Format {
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		n := 3 + len(r.Ctx)/2
+		b := make([]byte, 0, 64+16*n)
+
+		b = msgpackMapHeader(b, n)
+		b = msgpackString(b, r.KeyNames.Time)
+		b = msgpackTime(b, r.Time)
+		b = msgpackString(b, r.KeyNames.Lvl)
+		b = msgpackString(b, r.Lvl.String())
+		b = msgpackString(b, r.KeyNames.Msg)
+		b = msgpackString(b, r.Msg)
+
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			b = msgpackString(b, fmt.Sprint(r.Ctx[i]))
+			b = msgpackValue(b, r.Ctx[i+1])
+		}
+
+		return b
+	})
+}
+
+// msgpackValue appends the encoding of @v to @b
+func msgpackValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return msgpackInt(b, int64(v))
+	case int8:
+		return msgpackInt(b, int64(v))
+	case int16:
+		return msgpackInt(b, int64(v))
+	case int32:
+		return msgpackInt(b, int64(v))
+	case int64:
+		return msgpackInt(b, v)
+	case uint:
+		return msgpackUint(b, uint64(v))
+	case uint8:
+		return msgpackUint(b, uint64(v))
+	case uint16:
+		return msgpackUint(b, uint64(v))
+	case uint32:
+		return msgpackUint(b, uint64(v))
+	case uint64:
+		return msgpackUint(b, v)
+	case float32:
+		b = append(b, 0xca)
+		return binary.BigEndian.AppendUint32(b, math.Float32bits(v))
+	case float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	case string:
+		return msgpackString(b, v)
+	case []byte:
+		return msgpackBinary(b, v)
+	case time.Time:
+		return msgpackTime(b, v)
+	case error:
+		return msgpackString(b, v.Error())
+	case fmt.Stringer:
+		return msgpackString(b, v.String())
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return append(b, 0xc0)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return append(b, 0xc0)
+		}
+
+		b = msgpackArrayHeader(b, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			b = msgpackValue(b, rv.Index(i).Interface())
+		}
+		return b
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return append(b, 0xc0)
+		}
+
+		b = msgpackMapHeader(b, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			b = msgpackString(b, fmt.Sprint(iter.Key().Interface()))
+			b = msgpackValue(b, iter.Value().Interface())
+		}
+		return b
+	}
+
+	j, err := json.Marshal(v)
+	if err != nil {
+		return msgpackString(b, fmt.Sprintf("%+v", v))
+	}
+	return msgpackString(b, string(j))
+}
+
+func msgpackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return msgpackUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		b = append(b, 0xd1)
+		return binary.BigEndian.AppendUint16(b, uint16(i))
+	case i >= math.MinInt32:
+		b = append(b, 0xd2)
+		return binary.BigEndian.AppendUint32(b, uint32(i))
+	}
+	b = append(b, 0xd3)
+	return binary.BigEndian.AppendUint64(b, uint64(i))
+}
+
+func msgpackUint(b []byte, u uint64) []byte {
+	switch {
+	case u < 128:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		b = append(b, 0xcd)
+		return binary.BigEndian.AppendUint16(b, uint16(u))
+	case u <= math.MaxUint32:
+		b = append(b, 0xce)
+		return binary.BigEndian.AppendUint32(b, uint32(u))
+	}
+	b = append(b, 0xcf)
+	return binary.BigEndian.AppendUint64(b, u)
+}
+
+func msgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdb)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+func msgpackBinary(b []byte, p []byte) []byte {
+	n := len(p)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xc5)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xc6)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, p...)
+}
+
+func msgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xdc)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	}
+	b = append(b, 0xdd)
+	return binary.BigEndian.AppendUint32(b, uint32(n))
+}
+
+func msgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xde)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	}
+	b = append(b, 0xdf)
+	return binary.BigEndian.AppendUint32(b, uint32(n))
+}
+
+// msgpackTime appends @t as a timestamp 96 (ext type -1), which holds
+// any time to the nanosecond
+func msgpackTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xc7, 12, 0xff)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	return binary.BigEndian.AppendUint64(b, uint64(t.Unix()))
+}
@@ -0,0 +1,235 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// msgpackDecoder decodes the subset of MessagePack MsgpackFormat writes,
+// independently of the encoder, to check its output. Integers decode as
+// int64 or uint64, maps as map[string]interface{}.
+type msgpackDecoder struct {
+	b []byte
+}
+
+var errShort = errors.New("msgpack: short buffer")
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if len(d.b) < n {
+		return nil, errShort
+	}
+	p := d.b[:n]
+	d.b = d.b[n:]
+	return p, nil
+}
+
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	p, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range p {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	c := p[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	}
+
+	// the size of the length or value following c
+	sizes := map[byte]int{
+		0xc4: 1, 0xc5: 2, 0xc6: 4, 0xc7: 1, 0xca: 4, 0xcb: 8,
+		0xcc: 1, 0xcd: 2, 0xce: 4, 0xcf: 8, 0xd0: 1, 0xd1: 2, 0xd2: 4, 0xd3: 8,
+		0xd9: 1, 0xda: 2, 0xdb: 4, 0xdc: 2, 0xdd: 4, 0xde: 2, 0xdf: 4,
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	}
+
+	size, ok := sizes[c]
+	if !ok {
+		return nil, errors.New("msgpack: unexpected type byte")
+	}
+	u, err := d.uint(size)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c {
+	case 0xc4, 0xc5, 0xc6:
+		p, err := d.next(int(u))
+		return append([]byte{}, p...), err
+	case 0xc7:
+		return d.decodeTime(int(u))
+	case 0xca:
+		return math.Float32frombits(uint32(u)), nil
+	case 0xcb:
+		return math.Float64frombits(u), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return u, nil
+	case 0xd0:
+		return int64(int8(u)), nil
+	case 0xd1:
+		return int64(int16(u)), nil
+	case 0xd2:
+		return int64(int32(u)), nil
+	case 0xd3:
+		return int64(u), nil
+	case 0xd9, 0xda, 0xdb:
+		return d.decodeString(int(u))
+	case 0xdc, 0xdd:
+		return d.decodeArray(int(u))
+	}
+	return d.decodeMap(int(u))
+}
+
+func (d *msgpackDecoder) decodeString(n int) (interface{}, error) {
+	p, err := d.next(n)
+	return string(p), err
+}
+
+func (d *msgpackDecoder) decodeArray(n int) (interface{}, error) {
+	a := make([]interface{}, n)
+	for i := range a {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		ks, ok := k.(string)
+		if !ok {
+			return nil, errors.New("msgpack: map key is not a string")
+		}
+		if m[ks], err = d.decode(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// decodeTime decodes the ext 8 timestamp of @n bytes following its length
+func (d *msgpackDecoder) decodeTime(n int) (interface{}, error) {
+	p, err := d.next(1 + n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(p[0]) != -1 || n != 12 {
+		return nil, errors.New("msgpack: unexpected ext type")
+	}
+	nsec := binary.BigEndian.Uint32(p[1:5])
+	sec := binary.BigEndian.Uint64(p[5:13])
+	return time.Unix(int64(sec), int64(nsec)), nil
+}
+
+type point struct {
+	X, Y int
+}
+
+// TestMsgpackRoundTrip formats records with msgpack and decodes them back,
+// one after the other from the same buffer
+func TestMsgpackRoundTrip(t *testing.T) {
+	fmtr, err := MakeFormatter(HandlerConf{"msgpack"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	keys := log15.RecordKeyNames{Time: "t", Lvl: "lvl", Msg: "msg"}
+	long := strings.Repeat("x", 300)
+
+	records := []struct {
+		r    *log15.Record
+		want map[string]interface{}
+	}{{
+		&log15.Record{Time: now, Lvl: log15.LvlWarn, Msg: "disk low", KeyNames: keys, Ctx: []interface{}{
+			"free", 3, "neg", -100000, "big", uint64(math.MaxUint64), "ratio", 0.25, "f32", float32(1.5),
+			"ok", true, "none", nil, "raw", []byte{0, 1, 2}, "when", now.Add(time.Hour),
+			"err", errors.New("boom"), "tags", []string{"a", "b"}, "dims", map[string]int{"w": 2},
+			"pt", point{1, 2}, "long", long,
+		}},
+		map[string]interface{}{
+			"t": now, "lvl": "warn", "msg": "disk low",
+			"free": int64(3), "neg": int64(-100000), "big": uint64(math.MaxUint64), "ratio": 0.25, "f32": float32(1.5),
+			"ok": true, "none": nil, "raw": []byte{0, 1, 2}, "when": now.Add(time.Hour),
+			"err": "boom", "tags": []interface{}{"a", "b"}, "dims": map[string]interface{}{"w": int64(2)},
+			"pt": `{"X":1,"Y":2}`, "long": long,
+		},
+	}, {
+		&log15.Record{Time: now, Lvl: log15.LvlDebug, Msg: "", KeyNames: keys},
+		map[string]interface{}{"t": now, "lvl": "dbug", "msg": ""},
+	}}
+
+	var b []byte
+	for _, rec := range records {
+		b = append(b, fmtr.Format(rec.r)...)
+	}
+
+	d := &msgpackDecoder{b}
+	for i, rec := range records {
+		v, err := d.decode()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			t.Fatalf("record %d: expected a map, got %#v", i, v)
+		}
+		if tm, ok := m["t"].(time.Time); ok && tm.Equal(now) {
+			m["t"] = now
+		}
+		if tm, ok := m["when"].(time.Time); ok && tm.Equal(now.Add(time.Hour)) {
+			m["when"] = now.Add(time.Hour)
+		}
+
+		if !reflect.DeepEqual(m, rec.want) {
+			t.Errorf("record %d:\nexpected %#v\ngot      %#v", i, rec.want, m)
+		}
+	}
+
+	if len(d.b) != 0 {
+		t.Errorf("expected nothing after the records, got %d bytes", len(d.b))
+	}
+}
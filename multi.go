@@ -0,0 +1,75 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sort"
+)
+
+// MultiHandler writes every record to all of its children, exactly like
+// log15's MultiHandler, but also knows how to Close its children in a
+// defined order. Children are closed by ascending priority; children of
+// equal priority are closed in the order they were declared. This lets
+// a fast local sink (eg: a file) be flushed and closed before waiting on
+// a slow remote one.
+//
+// Children are flushed first if they are Flushable, and only those that
+// implement io.Closer are closed.
+type MultiHandler struct {
+	hs         []log15.Handler
+	closeOrder []log15.Handler
+}
+
+// MakeMultiHandler prepares a multi handler over @hs. @priorities, if
+// not nil, must be of the same length as @hs and gives the close
+// priority of each child (lower closes first).
+func MakeMultiHandler(hs []Handler, priorities []int) (*MultiHandler, error) {
+	if priorities != nil && len(priorities) != len(hs) {
+		return nil, fmt.Errorf("%w: %d priorities for %d handlers", BadConf, len(priorities), len(hs))
+	}
+
+	p := &MultiHandler{
+		hs:         make([]log15.Handler, len(hs)),
+		closeOrder: make([]log15.Handler, len(hs)),
+	}
+
+	idx := make([]int, len(hs))
+	for i, h := range hs {
+		p.hs[i] = h
+		idx[i] = i
+	}
+
+	if priorities != nil {
+		sort.SliceStable(idx, func(a, b int) bool {
+			return priorities[idx[a]] < priorities[idx[b]]
+		})
+	}
+
+	for i, j := range idx {
+		p.closeOrder[i] = p.hs[j]
+	}
+
+	return p, nil
+}
+
+func (p *MultiHandler) Log(r *log15.Record) error {
+	for _, h := range p.hs {
+		// what to do about failures?
+		h.Log(r)
+	}
+	return nil
+}
+
+// Close closes the children in priority order, waiting for each to
+// finish before moving on to the next. All children are closed even
+// if some fail; the first error encountered is returned.
+func (p *MultiHandler) Close() error {
+	var err error
+	for _, h := range p.closeOrder {
+		if e := closeTree(h); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,21 @@
+package log
+
+import "testing"
+
+// TestMultiClosePriority checks that Close closes the children of a multi
+// by ascending priority, then in declaration order, whatever the order
+// their sinks were built in
+func TestMultiClosePriority(t *testing.T) {
+	conf := HandlerConf{"multi",
+		10, HandlerConf{"test_closer", "net"},
+		0, HandlerConf{"test_closer", "file"},
+		HandlerConf{"caller_file", HandlerConf{"test_closer", "stream"}},
+	}
+
+	events := closeEvents(t, conf, func(Handler) { Close() })
+
+	want := []string{"flush file", "close file", "flush stream", "close stream", "flush net", "close net"}
+	if !equalEvents(events, want) {
+		t.Errorf("expected %v, got %v", want, events)
+	}
+}
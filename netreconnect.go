@@ -0,0 +1,195 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NetReconnectBufferSize is the number of records a NetReconnectHandler
+// holds while it is (re)connecting. When it is full the oldest are dropped.
+var NetReconnectBufferSize = 1000
+
+// NetRetryBackoff is how long a NetReconnectHandler waits before its first
+// attempt to reconnect, doubling after each failed attempt up to
+// NetMaxBackoff
+var (
+	NetRetryBackoff = 200 * time.Millisecond
+	NetMaxBackoff   = 30 * time.Second
+)
+
+// netTimeout bounds dialing and writing a record
+const netTimeout = 10 * time.Second
+
+// NetReconnectHandler writes formatted records to a network connection
+// like the "net" handler, but survives the remote going away: a failed
+// write closes the connection and it is dialled again with exponential
+// backoff, holding up to a buffer's worth of records meanwhile. Records
+// dropped because the buffer was full are counted (see Dropped), as are
+// the attempts to reconnect (see Reconnects).
+type NetReconnectHandler struct {
+	Network string
+	Address string
+
+	fmtr       Format
+	async      *AsyncHandler
+	backoff    time.Duration
+	maxBackoff time.Duration
+	conn       net.Conn      // only used by the async handler's goroutine
+	lost       chan struct{} // closed once conn is closed by the remote
+	done       chan struct{}
+	once       sync.Once
+	dropped    uint64
+	reconnects uint64
+}
+
+// MakeNetReconnectHandler prepares a handler sending records formatted
+// with @fmtr to @address over @network ("tcp", "udp", "unix", ...). It
+// doesn't dial right away, so it can be made while the remote is down;
+// records are buffered until it is up. An unknown @network is BadConf.
+func MakeNetReconnectHandler(network, address string, fmtr Format) (*NetReconnectHandler, error) {
+	return makeNetReconnectHandler(network, address, fmtr, nil,
+		NetReconnectBufferSize, NetRetryBackoff, NetMaxBackoff)
+}
+
+// makeNetReconnectHandler is MakeNetReconnectHandler starting with the
+// connection @conn, if not nil, and the given buffer size and backoffs
+func makeNetReconnectHandler(network, address string, fmtr Format, conn net.Conn,
+	size int, backoff, maxBackoff time.Duration) (*NetReconnectHandler, error) {
+
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix", "unixgram", "unixpacket":
+	default:
+		return nil, fmt.Errorf("%w: unknown network %q", BadConf, network)
+	}
+
+	p := &NetReconnectHandler{
+		Network:    network,
+		Address:    address,
+		fmtr:       fmtr,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		done:       make(chan struct{}),
+	}
+	if conn != nil {
+		p.setConn(conn)
+	}
+
+	var err error
+	p.async, err = MakeAsyncHandler(size, OverflowDropOld, log15.FuncHandler(p.write))
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *NetReconnectHandler) Log(r *log15.Record) error {
+	return p.async.Log(r)
+}
+
+// write sends @r, reconnecting as needed until it is sent. Once the
+// handler is closing it gives up after one failed attempt.
+func (p *NetReconnectHandler) write(r *log15.Record) error {
+	b := p.fmtr.Format(r)
+
+	backoff := p.backoff
+	for {
+		err := p.connect()
+		if err == nil {
+			p.conn.SetWriteDeadline(time.Now().Add(netTimeout))
+			if _, err = p.conn.Write(b); err == nil {
+				return nil
+			}
+
+			p.conn.Close()
+			p.conn = nil
+		}
+
+		select {
+		case <-p.done:
+			atomic.AddUint64(&p.dropped, 1)
+			return err
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
+
+// connect dials unless connected and the connection is up
+func (p *NetReconnectHandler) connect() error {
+	if p.conn != nil {
+		select {
+		case <-p.lost:
+			p.conn.Close()
+			p.conn = nil
+		default:
+			return nil
+		}
+	}
+
+	atomic.AddUint64(&p.reconnects, 1)
+	conn, err := net.DialTimeout(p.Network, p.Address, netTimeout)
+	if err != nil {
+		return err
+	}
+
+	p.setConn(conn)
+	return nil
+}
+
+// setConn makes @conn the connection and watches it: log sinks don't
+// write back, so a read returns only once the remote closed the
+// connection, after which writing would still succeed, losing records
+func (p *NetReconnectHandler) setConn(conn net.Conn) {
+	lost := make(chan struct{})
+	go func() {
+		var one [1]byte
+		for {
+			if _, err := conn.Read(one[:]); err != nil {
+				close(lost)
+				return
+			}
+		}
+	}()
+
+	p.conn, p.lost = conn, lost
+}
+
+// Reconnects returns the number of times the handler dialled, successfully
+// or not, after losing its connection or failing to make one
+func (p *NetReconnectHandler) Reconnects() uint64 {
+	return atomic.LoadUint64(&p.reconnects)
+}
+
+// Dropped returns the number of records that were discarded because the
+// buffer was full, or that could not be sent once the handler was closed
+func (p *NetReconnectHandler) Dropped() uint64 {
+	return p.async.Dropped() + atomic.LoadUint64(&p.dropped)
+}
+
+// Close sends the buffered records, giving up on them if the remote can't
+// be reached, and closes the connection. It is safe to call Close more
+// than once.
+func (p *NetReconnectHandler) Close() error {
+	var err error
+	p.once.Do(func() {
+		close(p.done)
+		p.async.Close()
+
+		if p.conn != nil {
+			err = p.conn.Close()
+			p.conn = nil
+		}
+	})
+	return err
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"os"
+)
+
+// OriginKey is the ctx key under which records sent over the network
+// are stamped with OriginID when loop detection is enabled
+var OriginKey = "origin"
+
+// OriginID uniquely identifies this process. It is only comparable
+// within a single run of the process.
+var OriginID = makeOriginID()
+
+// LoopDetection, when set before handlers are built, makes the network
+// sinks built by MakeHandler (http, kafka, logstash, net, net_reconnect,
+// redis) stamp every record with this process's OriginID and drop records
+// already carrying it. Such a record has come back around to us, eg: a
+// consumer of our redis channel that itself logs what it receives to the
+// same channel. Dropping it breaks the feedback loop before it amplifies.
+var LoopDetection = false
+
+func makeOriginID() string {
+	host, _ := os.Hostname()
+
+	b := make([]byte, 4)
+	rand.Read(b)
+
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
+
+// LoopGuardHandler returns a handler that drops records whose ctx
+// already carries OriginID under OriginKey and stamps all other records
+// with it before passing them on to @h. See LoopDetection.
+func LoopGuardHandler(h Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if r.Ctx[i] == OriginKey && r.Ctx[i+1] == OriginID {
+				return nil
+			}
+		}
+
+		rc := *r
+		rc.Ctx = append(r.Ctx[:len(r.Ctx):len(r.Ctx)], OriginKey, OriginID)
+		return h.Log(&rc)
+	})
+}
+
+// loopGuard wraps @h with LoopGuardHandler if LoopDetection is on,
+// closing @h when the guard is closed
+func loopGuard(h Handler, err error) (Handler, error) {
+	if err != nil || !LoopDetection {
+		return h, err
+	}
+	return withChildren(LoopGuardHandler(h), h), nil
+}
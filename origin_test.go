@@ -0,0 +1,56 @@
+package log
+
+import (
+	"bufio"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoopGuardLogstash checks that with LoopDetection a logstash handler
+// stamps records with OriginID, drops those that already carry it, and
+// still closes its connection when closed
+func TestLoopGuardLogstash(t *testing.T) {
+	defer func(old bool) { LoopDetection = old }(LoopDetection)
+	LoopDetection = true
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	h, err := MakeHandler(HandlerConf{"logstash", ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeHandler(h)
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	l := log15.New()
+	l.SetHandler(h)
+	l.Info("looped", OriginKey, OriginID)
+	l.Info("fresh")
+	closeHandler(h)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var lines []string
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("expected the connection closed, got %v", err)
+	}
+
+	if len(lines) != 1 || !strings.Contains(lines[0], `"msg":"fresh"`) || !strings.Contains(lines[0], OriginID) {
+		t.Errorf("expected only the fresh record, stamped, got %q", lines)
+	}
+}
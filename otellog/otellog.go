@@ -0,0 +1,67 @@
+// otellog package connects the log package with OpenTelemetry. It lives
+// apart from the log package so that the core does not depend on OTel.
+package otellog
+
+import (
+	"context"
+	"github.com/deep-compute/log"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the ctx keys of the trace and span ids added by FromContext and TraceCtx
+const (
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
+)
+
+// Baggage returns the W3C baggage members named by @keys that are
+// carried in @ctx, as ctx fields ready to be logged. Keys that are not
+// in the baggage are left out. eg:
+//	log.Info("order placed", otellog.Baggage(ctx, "tenant", "plan").Pairs()...)
+func Baggage(ctx context.Context, keys ...string) log.Ctx {
+	b := baggage.FromContext(ctx)
+
+	res := log.Ctx{}
+	for _, k := range keys {
+		m := b.Member(k)
+		if m.Key() == "" {
+			continue
+		}
+		res[k] = m.Value()
+	}
+
+	return res
+}
+
+// TraceCtx returns the ids of the OTel span carried in @ctx as ctx fields
+// TraceIDKey and SpanIDKey, in lowercase hex, or an empty Ctx if @ctx
+// carries no valid span
+func TraceCtx(ctx context.Context) log.Ctx {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return log.Ctx{}
+	}
+
+	return log.Ctx{
+		TraceIDKey: sc.TraceID().String(),
+		SpanIDKey:  sc.SpanID().String(),
+	}
+}
+
+// FromContext is log.FromContext adding the trace and span ids of the OTel
+// span carried in @ctx (see TraceCtx) to every record, so that logs can be
+// correlated with traces, eg:
+//	ctx, span := tracer.Start(r.Context(), "fetch")
+//	defer span.End()
+//	otellog.FromContext(ctx).Info("fetched", "rows", n)
+func FromContext(ctx context.Context) log.Logger {
+	l := log.FromContext(ctx)
+
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return l
+	}
+
+	return l.New(TraceIDKey, sc.TraceID().String(), SpanIDKey, sc.SpanID().String())
+}
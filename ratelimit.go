@@ -0,0 +1,60 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+)
+
+// RateLimitHandler returns a handler that forwards at most @perSecond
+// records a second to @h and drops the rest. It uses a token bucket
+// holding up to @perSecond tokens that refills continuously, so a burst
+// is let through up to the bucket size and then smoothed to the rate.
+// When throttling ends, ie: the first record after the bucket has filled
+// up again, a warning
+//	rate_limit dropped N messages
+// with dropped=N is forwarded ahead of that record.
+func RateLimitHandler(perSecond int, h Handler) Handler {
+	var (
+		mu      sync.Mutex
+		tokens  = float64(perSecond)
+		last    = Now()
+		dropped int
+	)
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		mu.Lock()
+		now := Now()
+		tokens += now.Sub(last).Seconds() * float64(perSecond)
+		if tokens > float64(perSecond) {
+			tokens = float64(perSecond)
+		}
+		last = now
+
+		if tokens < 1 {
+			dropped++
+			mu.Unlock()
+			return nil
+		}
+
+		// throttling is over once the bucket had time to fill up again
+		n := 0
+		if tokens == float64(perSecond) {
+			n, dropped = dropped, 0
+		}
+		tokens--
+		mu.Unlock()
+
+		if n > 0 {
+			h.Log(&log15.Record{
+				Time:     now,
+				Lvl:      log15.LvlWarn,
+				Msg:      fmt.Sprintf("rate_limit dropped %d messages", n),
+				Ctx:      []interface{}{"dropped", n},
+				KeyNames: r.KeyNames,
+			})
+		}
+
+		return h.Log(r)
+	})
+}
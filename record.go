@@ -0,0 +1,27 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"time"
+)
+
+// DefaultKeyNames are the names log15 uses for the built-in record keys
+var DefaultKeyNames = RecordKeyNames{Time: "t", Lvl: "lvl", Msg: "msg"}
+
+// NewRecord builds a record with a fixed time, level, message and ctx,
+// eg: to assert the exact output of a formatter in tests.
+func NewRecord(t time.Time, lvl Lvl, msg string, ctx ...interface{}) *Record {
+	return &Record{
+		Time:     t,
+		Lvl:      log15.Lvl(lvl),
+		Msg:      msg,
+		Ctx:      ctx,
+		KeyNames: log15.RecordKeyNames(DefaultKeyNames),
+	}
+}
+
+// FormatRecord formats @r with @f and returns the bytes that
+// a stream handler using @f would write.
+func FormatRecord(f Format, r *Record) []byte {
+	return f.Format((*log15.Record)(r))
+}
@@ -0,0 +1,236 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactPatterns holds the built-in patterns that can be enabled by name
+// in the "redact_patterns" handler instead of spelling out a regex.
+// Matches of "credit_card" are only redacted if they pass the Luhn check.
+var RedactPatterns = map[string]string{
+	"email":        `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+	"credit_card":  `\b(?:\d[ \-]?){12,18}\d\b`,
+	"ssn":          `\b\d{3}-\d{2}-\d{4}\b`,
+	"bearer_token": `(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`,
+}
+
+// creditCardRe is the compiled "credit_card" pattern, whose matches
+// RedactPatternsHandler checks with luhnValid
+var creditCardRe = regexp.MustCompile(RedactPatterns["credit_card"])
+
+// CompileRedactPatterns compiles @patterns into regular expressions.
+// Each entry is either the name of a built-in pattern (see RedactPatterns)
+// or a regular expression.
+func CompileRedactPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		if builtin, ok := RedactPatterns[p]; ok {
+			if p == "credit_card" && builtin == creditCardRe.String() {
+				res = append(res, creditCardRe)
+				continue
+			}
+			p = builtin
+		}
+
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", BadConf, err)
+		}
+		res = append(res, re)
+	}
+
+	return res, nil
+}
+
+// RedactPatternsHandler returns a handler that replaces every match of
+// @patterns in the message and in the ctx values before passing the
+// record on to @h. If @mask is "", each match is replaced by as many '*'
+// as it has characters (preserving length), otherwise by @mask itself.
+// Other ctx values are matched in their string form: []byte as text,
+// errors and fmt.Stringers as they print, and anything else, such as
+// maps, slices and structs, as fmt.Sprint prints it. A value in which
+// anything matched is replaced by its redacted string. Numbers and bools
+// are left alone, so that eg: numeric ids that happen to pass the Luhn
+// check aren't taken for card numbers.
+//
+// The record handed to @h is a copy, so sibling handlers in a multi
+// tree still see the original values.
+func RedactPatternsHandler(patterns []*regexp.Regexp, mask string, h Handler) Handler {
+	redact := func(s string) string {
+		for _, re := range patterns {
+			s = re.ReplaceAllStringFunc(s, func(m string) string {
+				if re == creditCardRe && !luhnValid(m) {
+					return m
+				}
+				if mask == "" {
+					return strings.Repeat("*", utf8.RuneCountInString(m))
+				}
+				return mask
+			})
+		}
+		return s
+	}
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		rc := *r
+		rc.Msg = redact(r.Msg)
+		rc.Ctx = make([]interface{}, len(r.Ctx))
+		copy(rc.Ctx, r.Ctx)
+
+		for i := 1; i < len(rc.Ctx); i += 2 {
+			var s string
+			switch v := rc.Ctx[i].(type) {
+			case string:
+				rc.Ctx[i] = redact(v)
+				continue
+			case []byte:
+				s = string(v)
+			case error, fmt.Stringer:
+				// Sprint recovers from nil receivers
+				s = fmt.Sprint(v)
+			case nil:
+				continue
+			default:
+				if k := reflect.ValueOf(v).Kind(); k >= reflect.Bool && k <= reflect.Complex128 {
+					continue
+				}
+				s = fmt.Sprint(v)
+			}
+
+			if rs := redact(s); rs != s {
+				rc.Ctx[i] = rs
+			}
+		}
+
+		return h.Log(&rc)
+	})
+}
+
+// luhnValid tells if the digits of @s pass the Luhn check of card numbers
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+
+	return n > 0 && sum%10 == 0
+}
+
+// redactMaxDepth bounds how deep RedactHandler looks into nested
+// values, so that a map holding itself doesn't recurse forever
+const redactMaxDepth = 16
+
+// RedactHandler returns a handler that replaces the values of the ctx
+// fields named in @keys, compared case-insensitively, with @replacement
+// before passing the record on to @h, eg: to keep passwords off disk
+//	RedactHandler([]string{"password", "ssn"}, "***", h)
+// Fields of maps logged as ctx values, and of maps in slices, are
+// redacted too; such a map is then logged as a map[string]interface{}
+// copy. Struct fields are not looked into.
+//
+// The record handed to @h is a copy, so sibling handlers in a multi
+// tree still see the original values.
+func RedactHandler(keys []string, replacement string, h Handler) Handler {
+	redacted := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		redacted[strings.ToLower(k)] = true
+	}
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		rc := *r
+		rc.Ctx = make([]interface{}, len(r.Ctx))
+		copy(rc.Ctx, r.Ctx)
+
+		for i := 0; i+1 < len(rc.Ctx); i += 2 {
+			if redacted[strings.ToLower(fmt.Sprint(rc.Ctx[i]))] {
+				rc.Ctx[i+1] = replacement
+			} else if v, ok := redactValue(reflect.ValueOf(rc.Ctx[i+1]), redacted, replacement, redactMaxDepth); ok {
+				rc.Ctx[i+1] = v
+			}
+		}
+
+		return h.Log(&rc)
+	})
+}
+
+// redactValue returns a copy of the map or slice @v with the values of
+// the @redacted keys replaced, and true, if it holds any such key
+// within @depth levels. Otherwise it returns false.
+func redactValue(v reflect.Value, redacted map[string]bool, replacement string, depth int) (interface{}, bool) {
+	if depth == 0 {
+		return nil, false
+	}
+
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		var res map[string]interface{}
+		iter := v.MapRange()
+		for iter.Next() {
+			k := fmt.Sprint(iter.Key().Interface())
+			if redacted[strings.ToLower(k)] {
+				if res == nil {
+					res = mapCopy(v)
+				}
+				res[k] = replacement
+			} else if e, ok := redactValue(iter.Value(), redacted, replacement, depth-1); ok {
+				if res == nil {
+					res = mapCopy(v)
+				}
+				res[k] = e
+			}
+		}
+		return res, res != nil
+
+	case reflect.Slice, reflect.Array:
+		var res []interface{}
+		for i := 0; i < v.Len(); i++ {
+			e, ok := redactValue(v.Index(i), redacted, replacement, depth-1)
+			if !ok {
+				continue
+			}
+
+			if res == nil {
+				res = make([]interface{}, v.Len())
+				for j := range res {
+					res[j] = v.Index(j).Interface()
+				}
+			}
+			res[i] = e
+		}
+		return res, res != nil
+	}
+
+	return nil, false
+}
+
+// mapCopy returns the map @v as a map[string]interface{}
+func mapCopy(v reflect.Value) map[string]interface{} {
+	res := make(map[string]interface{}, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		res[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+	}
+	return res
+}
@@ -0,0 +1,103 @@
+package log
+
+import (
+	"errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net"
+	"testing"
+)
+
+// cardHolder is a fmt.Stringer printing a card number
+type cardHolder struct{}
+
+func (*cardHolder) String() string {
+	return "card 4111 1111 1111 1111"
+}
+
+// TestRedactPatternsValues checks which ctx values redact_patterns
+// looks into: strings, errors and fmt.Stringers, but not numbers
+func TestRedactPatternsValues(t *testing.T) {
+	patterns, err := CompileRedactPatterns([]string{"credit_card", "email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []interface{}
+	h := RedactPatternsHandler(patterns, "***", log15.FuncHandler(func(r *log15.Record) error {
+		got = r.Ctx
+		return nil
+	}))
+
+	var nilHolder *cardHolder
+	ctx := []interface{}{
+		"card", "4111 1111 1111 1111",
+		"id", int64(4111111111111111),
+		"uid", uint64(4111111111111111),
+		"err", errors.New("no user bob@example.com"),
+		"holder", &cardHolder{},
+		"nil_holder", nilHolder,
+		"ip", net.IPv4(10, 0, 0, 1),
+		"ok", true,
+	}
+	h.Log(&log15.Record{Msg: "charged 4111 1111 1111 1111", Ctx: ctx})
+
+	want := []interface{}{
+		"card", "***",
+		"id", int64(4111111111111111),
+		"uid", uint64(4111111111111111),
+		"err", "no user ***",
+		"holder", "card ***",
+		"nil_holder", "card ***",
+		"ip", net.IPv4(10, 0, 0, 1),
+		"ok", true,
+	}
+	for i := 1; i < len(want); i += 2 {
+		if ip, ok := want[i].(net.IP); ok {
+			if !ip.Equal(got[i].(net.IP)) {
+				t.Errorf("%v: expected %v, got %v", want[i-1], want[i], got[i])
+			}
+		} else if got[i] != want[i] {
+			t.Errorf("%v: expected %#v, got %#v", want[i-1], want[i], got[i])
+		}
+	}
+	if ctx[1] != "4111 1111 1111 1111" {
+		t.Errorf("expected the original record left alone, got %v", ctx[1])
+	}
+}
+
+// TestRedactPatternsComposites checks that redact_patterns finds secrets
+// in []byte values and in the printed form of maps, slices and structs
+func TestRedactPatternsComposites(t *testing.T) {
+	patterns, err := CompileRedactPatterns([]string{"email", "bearer_token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []interface{}
+	h := RedactPatternsHandler(patterns, "***", log15.FuncHandler(func(r *log15.Record) error {
+		got = r.Ctx
+		return nil
+	}))
+
+	body := []byte(`{"to": "bob@example.com"}`)
+	ctx := []interface{}{
+		"body", body,
+		"headers", map[string]string{"Authorization": "Bearer abc.def"},
+		"to", []string{"bob@example.com"},
+		"user", struct{ Email string }{"bob@example.com"},
+		"counts", map[string]int{"bob": 1},
+	}
+	h.Log(&log15.Record{Msg: "sent", Ctx: ctx})
+
+	for i, want := range []string{`{"to": "***"}`, "map[Authorization:***]", "[***]", "{***}"} {
+		if s, ok := got[2*i+1].(string); !ok || s != want {
+			t.Errorf("%v: expected %q, got %#v", got[2*i], want, got[2*i+1])
+		}
+	}
+	if _, ok := got[9].(map[string]int); !ok {
+		t.Errorf("counts: expected the map left alone, got %#v", got[9])
+	}
+	if string(body) != `{"to": "bob@example.com"}` {
+		t.Errorf("expected the logged bytes left alone, got %q", body)
+	}
+}
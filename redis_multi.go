@@ -0,0 +1,130 @@
+package log
+
+import (
+	"errors"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// RedisReconnectInterval is the least time between two attempts to
+// reconnect to an unhealthy endpoint of a RedisMultiHandler
+var RedisReconnectInterval = time.Second
+
+type redisEndpoint struct {
+	loc string
+
+	mu          sync.Mutex
+	conn        redis.Conn
+	lastAttempt time.Time
+}
+
+func (p *redisEndpoint) publish(channel string, b []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if time.Since(p.lastAttempt) < RedisReconnectInterval {
+			return errors.New("redis endpoint " + p.loc + " is down")
+		}
+
+		p.lastAttempt = time.Now()
+		conn, err := redis.Dial("tcp", p.loc)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+
+	_, err := p.conn.Do("PUBLISH", channel, b)
+	if err != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+
+	return err
+}
+
+// RedisMultiHandler publishes every record to the same channel on
+// several independent redis instances for redundancy. A record is
+// considered logged if at least one instance accepts it. Each instance
+// is reconnected to independently of the others when it fails.
+type RedisMultiHandler struct {
+	Locs    []string
+	Channel string
+
+	endpoints []*redisEndpoint
+	formatter log15.Format
+}
+
+// Init connects to all the instances. It fails only if none of
+// them can be reached; the others are retried as records arrive.
+func (p *RedisMultiHandler) Init() error {
+	p.formatter = log15.JsonFormat()
+	p.endpoints = make([]*redisEndpoint, len(p.Locs))
+
+	var err error
+	up := 0
+	for i, loc := range p.Locs {
+		e := &redisEndpoint{loc: loc, lastAttempt: time.Now()}
+		e.conn, err = redis.Dial("tcp", loc)
+		if err == nil {
+			up++
+		}
+		p.endpoints[i] = e
+	}
+
+	if up == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func (p *RedisMultiHandler) Log(r *log15.Record) error {
+	b := p.formatter.Format(r)
+
+	var err error
+	ok := false
+	for _, e := range p.endpoints {
+		if e2 := e.publish(p.Channel, b); e2 != nil {
+			err = e2
+		} else {
+			ok = true
+		}
+	}
+
+	if ok {
+		return nil
+	}
+
+	return err
+}
+
+// Healthy reports which instances are currently connected
+func (p *RedisMultiHandler) Healthy() map[string]bool {
+	res := make(map[string]bool, len(p.endpoints))
+	for _, e := range p.endpoints {
+		e.mu.Lock()
+		res[e.loc] = e.conn != nil
+		e.mu.Unlock()
+	}
+	return res
+}
+
+// Close closes the connections to all the instances
+func (p *RedisMultiHandler) Close() error {
+	var err error
+	for _, e := range p.endpoints {
+		e.mu.Lock()
+		if e.conn != nil {
+			if e2 := e.conn.Close(); e2 != nil && err == nil {
+				err = e2
+			}
+			e.conn = nil
+		}
+		e.mu.Unlock()
+	}
+	return err
+}
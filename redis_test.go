@@ -0,0 +1,119 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/inconshreveable/log15.v2"
+	"testing"
+	"time"
+)
+
+// mockRedisConn records the commands it is given, failing all of them
+// once broken. It breaks on the first failCmd command it is given.
+type mockRedisConn struct {
+	broken  bool
+	failCmd string
+	cmds    []string
+}
+
+func (c *mockRedisConn) Close() error {
+	return nil
+}
+
+func (c *mockRedisConn) Err() error {
+	if c.broken {
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+func (c *mockRedisConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if c.broken || (cmd != "" && cmd == c.failCmd) {
+		c.broken = true
+		return nil, errors.New("connection reset")
+	}
+	// the pool flushes connections it takes back with an empty command
+	if cmd != "" {
+		c.cmds = append(c.cmds, cmd)
+	}
+	return int64(1), nil
+}
+
+func (c *mockRedisConn) Send(cmd string, args ...interface{}) error {
+	return nil
+}
+
+func (c *mockRedisConn) Flush() error {
+	return nil
+}
+
+func (c *mockRedisConn) Receive() (interface{}, error) {
+	return nil, nil
+}
+
+// TestRedisReconnect checks that a record that fails to be published on a
+// dropped connection is published again on a fresh one
+func TestRedisReconnect(t *testing.T) {
+	conns := []*mockRedisConn{{broken: true}, {}}
+	dials := 0
+
+	p := &RedisHandler{
+		Channel:   "logs",
+		formatter: log15.JsonFormat(),
+		pool: &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				c := conns[dials]
+				dials++
+				return c, nil
+			},
+		},
+	}
+
+	r := &log15.Record{Time: time.Now(), Lvl: log15.LvlInfo, Msg: "hello"}
+	if err := p.Log(r); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+
+	if dials != 2 {
+		t.Errorf("expected 2 dials, got %d", dials)
+	}
+	if cmds := conns[1].cmds; len(cmds) != 1 || cmds[0] != "PUBLISH" {
+		t.Errorf("expected a PUBLISH on the fresh connection, got %v", cmds)
+	}
+}
+
+// TestRedisRetryOnlyFailedCommand checks that when trimming the list fails
+// after the record was pushed, only the trim is retried
+func TestRedisRetryOnlyFailedCommand(t *testing.T) {
+	conns := []*mockRedisConn{{failCmd: "LTRIM"}, {}}
+	dials := 0
+
+	p := &RedisHandler{
+		Channel:   "logs",
+		Mode:      "list",
+		MaxLen:    100,
+		AliveKey:  "alive",
+		AliveTTL:  10,
+		formatter: log15.JsonFormat(),
+		pool: &redis.Pool{
+			Dial: func() (redis.Conn, error) {
+				c := conns[dials]
+				dials++
+				return c, nil
+			},
+		},
+	}
+
+	r := &log15.Record{Time: time.Now(), Lvl: log15.LvlInfo, Msg: "hello"}
+	if err := p.Log(r); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+
+	want := [][]string{{"LPUSH"}, {"LTRIM", "SET"}}
+	for i, c := range conns {
+		if fmt.Sprint(c.cmds) != fmt.Sprint(want[i]) {
+			t.Errorf("connection %d: expected %v, got %v", i, want[i], c.cmds)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package log
+
+import (
+	"fmt"
+	"sync"
+)
+
+// HandlerFactory builds a handler registered with RegisterHandler out
+// of the arguments following its name in a HandlerConf
+type HandlerFactory func(args []interface{}) (Handler, error)
+
+// FormatterFactory builds a format registered with RegisterFormatter
+// out of the arguments following its name in a format conf. A format
+// given by name alone gets no arguments.
+type FormatterFactory func(args []interface{}) (Format, error)
+
+// SafeRegisteredHandlers makes MakeHandler wrap every handler built by a
+// registered factory with SafeHandler, so that a panicking custom handler
+// returns an error instead of crashing the application.
+var SafeRegisteredHandlers = false
+
+// names understood by MakeHandler and MakeFormatter out of the box, which
+// can't be registered. keep these in sync with their switches.
+var (
+	builtinHandlers = map[string]bool{
+		"async": true, "buffered": true, "caller_file": true, "caller_func": true,
+		"caller_pkg": true, "caller_stack": true, "caller_stack_structured": true, "cloudwatch": true,
+		"dedup": true, "delayed_sample": true, "dict_compress": true, "discard": true,
+		"drop_fields": true, "dual_format": true, "error_caller": true, "error_stack": true,
+		"escalate_repeat": true, "failover": true, "file": true, "file_sync": true, "geoip": true,
+		"goroutine_ctx": true, "http": true, "kafka": true, "lazy": true, "level_filter": true,
+		"level_from_field": true, "level_route": true, "level_router": true, "level_sample": true, "logstash": true,
+		"match_all": true, "match_any": true, "match_filter": true, "max_depth": true, "metrics": true, "monotonic": true, "multi": true,
+		"net": true, "net_reconnect": true, "not_match_filter": true, "project_fields": true, "rate_limit": true, "redact": true, "redact_pattern": true, "redact_patterns": true,
+		"redis": true, "redis_multi": true, "redis_tls": true, "request_buffer": true, "ring": true,
+		"rotating_file": true, "safe": true, "sample": true, "sentry": true, "span_timer": true, "stats": true,
+		"stream": true, "swappable": true, "sync": true, "syslog": true,
+		"syslog_net": true, "timed_rotating_file": true, "tty_stream": true,
+		"unique_id": true,
+	}
+
+	builtinFormatters = map[string]bool{
+		"cef": true, "csv": true, "gelf": true, "json": true,
+		"json_flat": true, "json_pretty": true, "logfmt": true, "msgpack": true, "otel_json": true,
+		"stackdriver": true, "syslog_rfc5424": true, "terminal": true, "terminal_color": true,
+	}
+)
+
+var registry struct {
+	sync.RWMutex
+	handlers   map[string]HandlerFactory
+	formatters map[string]FormatterFactory
+}
+
+// RegisterHandler makes MakeHandler build handlers named @name with
+// @factory, eg: a company internal sink can then be configured as
+//	HandlerConf{"my_sink", "addr", HandlerConf{...}}
+// It returns BadConf if @name is a built-in handler or already registered.
+func RegisterHandler(name string, factory HandlerFactory) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if name == "" || factory == nil {
+		return fmt.Errorf("%w: handler %q: missing name or factory", BadConf, name)
+	}
+	if builtinHandlers[name] || registry.handlers[name] != nil {
+		return fmt.Errorf("%w: handler %q is already defined", BadConf, name)
+	}
+
+	if registry.handlers == nil {
+		registry.handlers = make(map[string]HandlerFactory)
+	}
+	registry.handlers[name] = factory
+	return nil
+}
+
+// RegisterFormatter makes MakeFormatter build formats named @name with
+// @factory. It returns BadConf if @name is a built-in format or already
+// registered.
+func RegisterFormatter(name string, factory FormatterFactory) error {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if name == "" || factory == nil {
+		return fmt.Errorf("%w: format %q: missing name or factory", BadConf, name)
+	}
+	if builtinFormatters[name] || registry.formatters[name] != nil {
+		return fmt.Errorf("%w: format %q is already defined", BadConf, name)
+	}
+
+	if registry.formatters == nil {
+		registry.formatters = make(map[string]FormatterFactory)
+	}
+	registry.formatters[name] = factory
+	return nil
+}
+
+func registeredHandler(name string) HandlerFactory {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.handlers[name]
+}
+
+func registeredFormatter(name string) FormatterFactory {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.formatters[name]
+}
@@ -0,0 +1,188 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// reopenFile is a file that can be reopened at its path,
+// eg: after logrotate renamed it
+type reopenFile struct {
+	path   string
+	mu     sync.Mutex
+	f      *os.File
+	closed bool
+
+	syncEvery int // fsync after this many writes, 0 never
+	unsynced  int // writes since the last fsync
+}
+
+// the files of the "file" handlers that are open
+var reopenFiles struct {
+	sync.Mutex
+	files map[*reopenFile]struct{}
+}
+
+func openReopenFile(path string, syncEvery int) (*reopenFile, error) {
+	p := &reopenFile{path: path, syncEvery: syncEvery}
+	if err := p.open(); err != nil {
+		return nil, err
+	}
+
+	reopenFiles.Lock()
+	defer reopenFiles.Unlock()
+
+	if reopenFiles.files == nil {
+		reopenFiles.files = make(map[*reopenFile]struct{})
+	}
+	reopenFiles.files[p] = struct{}{}
+
+	return p, nil
+}
+
+// open (re)opens the file at its path, closing the previous one.
+// A closed file is left closed.
+func (p *reopenFile) open() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+
+	f, err := os.OpenFile(p.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	old := p.f
+	p.f = f
+	if old != nil {
+		err := p.sync(old)
+		if e := old.Close(); err == nil {
+			err = e
+		}
+		return err
+	}
+	return nil
+}
+
+// sync fsyncs @f if it was written to since the last fsync
+func (p *reopenFile) sync(f *os.File) error {
+	if p.unsynced == 0 {
+		return nil
+	}
+	p.unsynced = 0
+	return f.Sync()
+}
+
+func (p *reopenFile) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	n, err := p.f.Write(b)
+	if err != nil || p.syncEvery <= 0 {
+		return n, err
+	}
+
+	p.unsynced++
+	if p.unsynced < p.syncEvery {
+		return n, nil
+	}
+	return n, p.sync(p.f)
+}
+
+func (p *reopenFile) Close() error {
+	reopenFiles.Lock()
+	delete(reopenFiles.files, p)
+	reopenFiles.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	err := p.sync(p.f)
+	if e := p.f.Close(); err == nil {
+		err = e
+	}
+	p.f = nil
+	return err
+}
+
+// fileHandler is log15.FileHandler writing to a file that is closed by
+// Close and reopened by ReopenFiles
+func fileHandler(path string, fmtr Format) (*closingHandler, error) {
+	return fileSyncHandler(path, fmtr, 0)
+}
+
+// fileSyncHandler is fileHandler calling fsync after every @syncEvery
+// records, so that they survive a crash or a power loss (0 never does).
+// fsync waits for the disk: in BenchmarkFileSync, writing json records to
+// an SSD took ~74µs a record syncing each one against ~5µs without
+// syncing. Syncing every N records bounds what may be lost to N-1 records
+// for less (~18µs at 10, ~8µs at 100).
+// Pending records are synced when the file is reopened or closed.
+func fileSyncHandler(path string, fmtr Format, syncEvery int) (*closingHandler, error) {
+	f, err := openReopenFile(path, syncEvery)
+	if err != nil {
+		return nil, err
+	}
+	return &closingHandler{Handler: log15.StreamHandler(f, fmtr), c: f}, nil
+}
+
+// ReopenFiles reopens the files written by "file" handlers at their
+// paths, so that logging moves on to a new file after an external tool
+// such as logrotate renamed the old one. All files are reopened even
+// if some fail; the first error is returned. See HandleSIGHUP.
+func ReopenFiles() error {
+	reopenFiles.Lock()
+	files := make([]*reopenFile, 0, len(reopenFiles.files))
+	for f := range reopenFiles.files {
+		files = append(files, f)
+	}
+	reopenFiles.Unlock()
+
+	var err error
+	for _, f := range files {
+		if e := f.open(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+var handleSIGHUP sync.Once
+
+// HandleSIGHUP makes the process call ReopenFiles whenever it receives
+// SIGHUP, as logrotate's postrotate scripts commonly send, eg:
+//	postrotate
+//		kill -HUP $(cat /var/run/app.pid)
+//	endscript
+// Failures to reopen are logged through the root logger. Calling it more
+// than once has no further effect.
+func HandleSIGHUP() {
+	handleSIGHUP.Do(func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGHUP)
+
+		go func() {
+			for range sigs {
+				if err := ReopenFiles(); err != nil {
+					Error("reopening log files", "err", err)
+				}
+			}
+		}()
+	})
+}
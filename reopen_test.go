@@ -0,0 +1,52 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// benchmarkFile logs json records to a file_sync handler syncing every
+// @syncEvery records, 0 being the "file" handler
+func benchmarkFile(b *testing.B, syncEvery int) {
+	fmtr, err := MakeFormatter(HandlerConf{"json"})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	h, err := fileSyncHandler(filepath.Join(b.TempDir(), "log"), fmtr, syncEvery)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer h.Close()
+
+	r := &log15.Record{
+		Time:     time.Now(),
+		Lvl:      log15.LvlInfo,
+		Msg:      "request served",
+		Ctx:      []interface{}{"method", "GET", "path", "/api/items", "status", 200, "ms", 12.5},
+		KeyNames: log15.RecordKeyNames{Time: "t", Lvl: "lvl", Msg: "msg"},
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := h.Log(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFileSync measures the cost of fsync against the "file"
+// handler, giving the numbers documented with file_sync:
+//	go test -run '^$' -bench FileSync
+func BenchmarkFileSync(b *testing.B) {
+	for _, n := range []int{0, 1, 10, 100} {
+		name := fmt.Sprintf("sync_every=%d", n)
+		if n == 0 {
+			name = "file"
+		}
+		b.Run(name, func(b *testing.B) { benchmarkFile(b, n) })
+	}
+}
@@ -0,0 +1,264 @@
+package log
+
+import (
+	"container/list"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// RequestBufferMaxRequests bounds the number of requests a
+// RequestBufferHandler holds records for, and RequestBufferMaxAge how
+// long it holds them. They are the defaults of its MaxRequests and
+// MaxAge.
+var (
+	RequestBufferMaxRequests = 10000
+	RequestBufferMaxAge      = 5 * time.Minute
+)
+
+// RequestBufferHandler holds records carrying a request id (ctx key Key,
+// "req_id" by default) until the request completes. Middleware then calls
+// Commit to write out the whole request's records together, or Discard to
+// drop them (eg: for successful requests, to reduce volume). Request ids
+// that are not strings are keyed by their fmt.Sprint form, eg: the records
+// of req_id=42 are committed with Commit("42").
+//
+// Records without a request id are passed straight through to the
+// wrapped handler. The records of a request are written out in one batch
+// that records of other requests, or passed through, don't interleave.
+// Requests that are neither committed nor discarded, eg: because the
+// request handler panicked past the middleware, are written out as with
+// Commit once there are more than MaxRequests or they are older than
+// MaxAge, so that they are neither lost nor held forever. Age is checked
+// as records are logged, and periodically so that the requests buffered
+// are still written out on time when no more records come in. Close
+// writes out those left, oldest request first.
+type RequestBufferHandler struct {
+	Key string
+
+	// KeepErrors makes Discard write out the buffered records anyway
+	// if any one of them is at error level or above
+	KeepErrors bool
+
+	// MaxRequests and MaxAge bound the requests buffered, 0 not at all
+	MaxRequests int
+	MaxAge      time.Duration
+
+	h       log15.Handler
+	mu      sync.Mutex
+	reqs    map[string]*list.Element // of *requestRecords in order
+	order   *list.List               // oldest request first
+	flushMu sync.Mutex               // held while writing to h
+	done    chan struct{}            // stops checkAge, nil until it runs
+	closed  bool
+}
+
+// requestRecords are the records buffered for a request
+type requestRecords struct {
+	id    string
+	start time.Time
+	recs  []*log15.Record
+}
+
+// MakeRequestBufferHandler prepares a request buffering handler
+// in front of @h. See RequestBufferHandler for details.
+func MakeRequestBufferHandler(keepErrors bool, h Handler) *RequestBufferHandler {
+	return &RequestBufferHandler{
+		Key:         "req_id",
+		KeepErrors:  keepErrors,
+		MaxRequests: RequestBufferMaxRequests,
+		MaxAge:      RequestBufferMaxAge,
+		h:           h,
+		reqs:        make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+func (p *RequestBufferHandler) Log(r *log15.Record) error {
+	reqID, ok := p.requestID(r)
+	if !ok {
+		p.flushMu.Lock()
+		defer p.flushMu.Unlock()
+		return p.h.Log(r)
+	}
+
+	p.mu.Lock()
+	e, ok := p.reqs[reqID]
+	if !ok {
+		e = p.order.PushBack(&requestRecords{id: reqID, start: Now()})
+		p.reqs[reqID] = e
+	}
+	req := e.Value.(*requestRecords)
+	req.recs = append(req.recs, r)
+	expired := p.expire()
+	if p.done == nil && !p.closed && p.MaxAge > 0 {
+		p.done = make(chan struct{})
+		go p.checkAge(p.done, p.MaxAge)
+	}
+	p.mu.Unlock()
+
+	var err error
+	for _, recs := range expired {
+		if e := p.flush(recs); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// expire removes the oldest requests while there are more than
+// MaxRequests or they are older than MaxAge and returns their records
+func (p *RequestBufferHandler) expire() [][]*log15.Record {
+	var res [][]*log15.Record
+
+	now := Now()
+	for e := p.order.Front(); e != nil; e = p.order.Front() {
+		req := e.Value.(*requestRecords)
+
+		over := p.MaxRequests > 0 && p.order.Len() > p.MaxRequests
+		old := p.MaxAge > 0 && now.Sub(req.start) >= p.MaxAge
+		if !over && !old {
+			break
+		}
+
+		p.order.Remove(e)
+		delete(p.reqs, req.id)
+		res = append(res, req.recs)
+	}
+
+	return res
+}
+
+// checkAge writes out the requests older than @maxAge every tenth of it
+// until @done is closed. There is no one to return errors to, so they
+// are dropped.
+func (p *RequestBufferHandler) checkAge(done chan struct{}, maxAge time.Duration) {
+	interval := maxAge / 10
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			p.mu.Lock()
+			expired := p.expire()
+			p.mu.Unlock()
+
+			for _, recs := range expired {
+				p.flush(recs)
+			}
+		}
+	}
+}
+
+// Commit writes out all the records buffered for @reqID
+// in the order they were logged
+func (p *RequestBufferHandler) Commit(reqID string) error {
+	return p.flush(p.take(reqID))
+}
+
+// Discard drops all the records buffered for @reqID unless
+// KeepErrors is set and one of them is at error level or above,
+// in which case they are all written out as with Commit.
+func (p *RequestBufferHandler) Discard(reqID string) error {
+	recs := p.take(reqID)
+
+	if p.KeepErrors {
+		for _, r := range recs {
+			if r.Lvl <= log15.LvlError {
+				return p.flush(recs)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *RequestBufferHandler) take(reqID string) []*log15.Record {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.reqs[reqID]
+	if !ok {
+		return nil
+	}
+
+	p.order.Remove(e)
+	delete(p.reqs, reqID)
+	return e.Value.(*requestRecords).recs
+}
+
+func (p *RequestBufferHandler) flush(recs []*log15.Record) error {
+	if len(recs) == 0 {
+		return nil
+	}
+
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	var err error
+	for _, r := range recs {
+		if e := p.h.Log(r); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+func (p *RequestBufferHandler) requestID(r *log15.Record) (string, bool) {
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		if r.Ctx[i] != p.Key {
+			continue
+		}
+
+		switch reqID := r.Ctx[i+1].(type) {
+		case string:
+			return reqID, true
+		case nil:
+			return "", false
+		default:
+			return fmt.Sprint(reqID), true
+		}
+	}
+
+	return "", false
+}
+
+// Close writes out the records still buffered as with Commit, oldest
+// request first, then flushes and closes the wrapped handler if it needs
+// it. All are written out even if some fail; the first error is returned.
+func (p *RequestBufferHandler) Close() error {
+	p.mu.Lock()
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+	p.closed = true
+
+	var pending [][]*log15.Record
+	for e := p.order.Front(); e != nil; e = e.Next() {
+		pending = append(pending, e.Value.(*requestRecords).recs)
+	}
+	p.order.Init()
+	p.reqs = make(map[string]*list.Element)
+	p.mu.Unlock()
+
+	var err error
+	for _, recs := range pending {
+		if e := p.flush(recs); e != nil && err == nil {
+			err = e
+		}
+	}
+	if e := closeTree(p.h); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
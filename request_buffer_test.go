@@ -0,0 +1,173 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// msgsHandler collects the messages of the records it is given
+type msgsHandler struct {
+	sync.Mutex
+	msgs []string
+}
+
+func (p *msgsHandler) Log(r *log15.Record) error {
+	// let concurrent writers in between records
+	runtime.Gosched()
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.msgs = append(p.msgs, r.Msg)
+	return nil
+}
+
+func (p *msgsHandler) String() string {
+	p.Lock()
+	defer p.Unlock()
+
+	return strings.Join(p.msgs, " ")
+}
+
+func reqRecord(reqID interface{}, msg string) *log15.Record {
+	return &log15.Record{Lvl: log15.LvlInfo, Msg: msg, Ctx: []interface{}{"req_id", reqID}}
+}
+
+// TestRequestBufferBatches checks that requests committed concurrently
+// are written out in one piece each
+func TestRequestBufferBatches(t *testing.T) {
+	sink := &msgsHandler{}
+	p := MakeRequestBufferHandler(false, sink)
+
+	const reqs, recs = 20, 50
+	for i := 0; i < reqs; i++ {
+		for j := 0; j < recs; j++ {
+			p.Log(reqRecord(fmt.Sprint(i), fmt.Sprint(i)))
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < reqs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p.Commit(fmt.Sprint(i))
+		}(i)
+	}
+	wg.Wait()
+
+	msgs := sink.msgs
+	if len(msgs) != reqs*recs {
+		t.Fatalf("expected %d records, got %d", reqs*recs, len(msgs))
+	}
+	for i := 0; i < len(msgs); i += recs {
+		for _, m := range msgs[i : i+recs] {
+			if m != msgs[i] {
+				t.Fatalf("records %d to %d: expected one request, got %v", i, i+recs, msgs[i:i+recs])
+			}
+		}
+	}
+}
+
+// TestRequestBufferIDs checks that non string request ids are buffered
+// under their printed form, and nil ones passed through
+func TestRequestBufferIDs(t *testing.T) {
+	sink := &msgsHandler{}
+	p := MakeRequestBufferHandler(false, sink)
+
+	p.Log(reqRecord(42, "a"))
+	p.Log(reqRecord(nil, "b"))
+	p.Log(reqRecord(int64(42), "c"))
+
+	if s := sink.String(); s != "b" {
+		t.Errorf("expected only the record without an id, got %q", s)
+	}
+
+	p.Commit("42")
+	if s := sink.String(); s != "b a c" {
+		t.Errorf("expected request 42 committed, got %q", s)
+	}
+}
+
+// TestRequestBufferExpiry checks that requests never committed are
+// written out past MaxRequests of them or once older than MaxAge
+func TestRequestBufferExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func(old func() time.Time) { Now = old }(Now)
+	Now = func() time.Time { return now }
+
+	sink := &msgsHandler{}
+	p := MakeRequestBufferHandler(false, sink)
+	p.MaxRequests, p.MaxAge = 2, time.Minute
+	defer p.Close()
+
+	p.Log(reqRecord("1", "1a"))
+	p.Log(reqRecord("2", "2a"))
+	p.Log(reqRecord("1", "1b"))
+	if s := sink.String(); s != "" {
+		t.Fatalf("expected nothing written yet, got %q", s)
+	}
+
+	p.Log(reqRecord("3", "3a"))
+	if s := sink.String(); s != "1a 1b" {
+		t.Fatalf("expected the oldest request written out, got %q", s)
+	}
+
+	now = now.Add(time.Minute)
+	p.Log(reqRecord("4", "4a"))
+	if s := sink.String(); s != "1a 1b 2a 3a" {
+		t.Fatalf("expected the requests a minute old written out, got %q", s)
+	}
+
+	p.Discard("4")
+	p.Discard("1")
+	if s := sink.String(); s != "1a 1b 2a 3a" {
+		t.Errorf("expected nothing more written, got %q", s)
+	}
+	if p.order.Len() != 0 || len(p.reqs) != 0 {
+		t.Errorf("expected nothing buffered, got %d requests", len(p.reqs))
+	}
+}
+
+// TestRequestBufferIdleExpiry checks that a request older than MaxAge is
+// written out even though no more records are logged
+func TestRequestBufferIdleExpiry(t *testing.T) {
+	sink := &msgsHandler{}
+	p := MakeRequestBufferHandler(false, sink)
+	p.MaxAge = 20 * time.Millisecond
+	defer p.Close()
+
+	p.Log(reqRecord("1", "1a"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for sink.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s := sink.String(); s != "1a" {
+		t.Errorf("expected the idle request written out, got %q", s)
+	}
+}
+
+// TestRequestBufferClose checks that Close writes out the requests still
+// buffered, oldest first
+func TestRequestBufferClose(t *testing.T) {
+	sink := &msgsHandler{}
+	p := MakeRequestBufferHandler(false, sink)
+
+	p.Log(reqRecord("1", "1a"))
+	p.Log(reqRecord("2", "2a"))
+	p.Log(reqRecord("1", "1b"))
+	p.Commit("2")
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s := sink.String(); s != "2a 1a 1b" {
+		t.Errorf("expected request 1 written out on Close, got %q", s)
+	}
+}
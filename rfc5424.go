@@ -0,0 +1,82 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// RFC5424SDID is the SD-ID of the STRUCTURED-DATA element carrying
+// the ctx fields in the "syslog_rfc5424" format
+const RFC5424SDID = "ctx@32473"
+
+// syslog severities of the log15 levels
+var syslogSeverities = map[Lvl]int{
+	LvlCrit:  2,
+	LvlError: 3,
+	LvlWarn:  4,
+	LvlInfo:  6,
+	LvlDebug: 7,
+}
+
+const syslogFacilityUser = 1
+
+var (
+	// SD-NAMEs are printable ASCII except '=', ' ', ']' and '"'
+	sdNameRe       = regexp.MustCompile(`[^!-~]|[= \]"]`)
+	sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+)
+
+// RFC5424Format renders each record as an RFC5424 syslog line:
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [ctx@32473 k="v" ...] MSG
+// with the user facility, the record's level as severity, and no MSGID.
+// @app is the APP-NAME; "" means the name of the running binary. The ctx
+// fields make up the STRUCTURED-DATA element, or "-" if there are none.
+func RFC5424Format(app string) Format {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "-"
+	}
+	if app == "" {
+		app = filepath.Base(os.Args[0])
+	}
+	app = sdNameRe.ReplaceAllString(app, "_")
+	pid := os.Getpid()
+
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		b := &bytes.Buffer{}
+		fmt.Fprintf(b, "<%d>1 %s %s %s %d - ",
+			syslogFacilityUser*8+syslogSeverities[Lvl(r.Lvl)],
+			r.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+			host, app, pid)
+
+		if len(r.Ctx) < 2 {
+			b.WriteByte('-')
+		} else {
+			b.WriteString("[" + RFC5424SDID)
+			for i := 0; i+1 < len(r.Ctx); i += 2 {
+				k := sdNameRe.ReplaceAllString(fmt.Sprint(r.Ctx[i]), "_")
+				if len(k) > 32 {
+					k = k[:32]
+				}
+
+				v := r.Ctx[i+1]
+				if err, ok := v.(error); ok {
+					v = err.Error()
+				}
+
+				fmt.Fprintf(b, ` %s="%s"`, k, sdValueEscaper.Replace(fmt.Sprintf("%+v", v)))
+			}
+			b.WriteByte(']')
+		}
+
+		b.WriteByte(' ')
+		b.WriteString(r.Msg)
+		b.WriteByte('\n')
+		return b.Bytes()
+	})
+}
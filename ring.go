@@ -0,0 +1,86 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net/http"
+	"sync"
+)
+
+// RingHandler forwards records to the wrapped handler and also keeps the
+// last few of them, formatted, in a circular buffer, so that an
+// application can show its recent logs without tailing files. It is an
+// http.Handler too, eg: mounted on /debug/logs it serves the buffered
+// records, oldest first.
+type RingHandler struct {
+	h         Handler
+	formatter log15.Format
+	ctype     string // of the formatted records
+
+	mu   sync.Mutex
+	recs [][]byte
+	next int // where the next record goes
+	full bool
+}
+
+// MakeRingHandler prepares a ring handler keeping the last @size records
+// formatted as per @format and forwarding all records to @h
+func MakeRingHandler(size int, format FormatConf, h Handler) (*RingHandler, error) {
+	if size < 1 {
+		return nil, fmt.Errorf("%w: expected a ring size of at least 1, got %d", BadConf, size)
+	}
+
+	formatter, err := MakeFormatter(format)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RingHandler{
+		h:         h,
+		formatter: formatter,
+		ctype:     contentType(format),
+		recs:      make([][]byte, size),
+	}, nil
+}
+
+func (p *RingHandler) Log(r *log15.Record) error {
+	b := p.formatter.Format(r)
+
+	p.mu.Lock()
+	p.recs[p.next] = b
+	p.next++
+	if p.next == len(p.recs) {
+		p.next, p.full = 0, true
+	}
+	p.mu.Unlock()
+
+	return p.h.Log(r)
+}
+
+// Snapshot returns the buffered records, oldest first. It may be called
+// while records are being logged.
+func (p *RingHandler) Snapshot() [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.full {
+		return append([][]byte(nil), p.recs[:p.next]...)
+	}
+
+	res := make([][]byte, 0, len(p.recs))
+	res = append(res, p.recs[p.next:]...)
+	return append(res, p.recs[:p.next]...)
+}
+
+func (p *RingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", p.ctype)
+	for _, b := range p.Snapshot() {
+		w.Write(b)
+	}
+}
+
+// Close flushes and closes the wrapped handler if it needs it. The
+// buffered records can still be read.
+func (p *RingHandler) Close() error {
+	return closeTree(p.h)
+}
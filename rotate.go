@@ -0,0 +1,437 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RotatingFile is a file writer that rolls the file over to numbered
+// backups (path.1 being the newest) when it grows past MaxBytes or gets
+// older than MaxAge, whichever happens first. At most MaxBackups backups
+// are kept. With Compress set, backups are gzipped (path.1.gz).
+//
+// Rolling over only moves the file aside (as path.rotating-*) and opens a
+// new one; shifting the backups and compressing happen in the background
+// so that logging isn't held up. If rolling over fails, writes go on to
+// the current file and it is retried on the next one.
+//
+// Both triggers are checked on every write. The age trigger is also
+// checked periodically so that an idle file is still rolled over on time.
+type RotatingFile struct {
+	Path       string
+	MaxBytes   int64         // 0 disables size based rotation
+	MaxAge     time.Duration // 0 disables age based rotation
+	MaxBackups int
+	Compress   bool
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	opened   time.Time
+	done     chan struct{}
+	rotated  []string // files moved aside, oldest first, not yet backups
+	shifting bool     // a shiftBackups goroutine is running
+	shifts   sync.WaitGroup
+}
+
+// Open opens (or creates) the file for appending and starts
+// the age check if MaxAge is set
+func (p *RotatingFile) Open() error {
+	if p.MaxBackups < 1 {
+		return fmt.Errorf("%w: expected at least 1 backup, got %d", BadConf, p.MaxBackups)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.open(); err != nil {
+		return err
+	}
+
+	if p.MaxAge > 0 {
+		p.done = make(chan struct{})
+		go p.checkAge(p.done)
+	}
+
+	return nil
+}
+
+func (p *RotatingFile) open() error {
+	f, err := os.OpenFile(p.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	p.f, p.size, p.opened = f, fi.Size(), Now()
+	return nil
+}
+
+func (p *RotatingFile) checkAge(done chan struct{}) {
+	interval := p.MaxAge / 10
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			p.mu.Lock()
+			if p.f != nil && p.due(0) {
+				p.rotate()
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// due tells if the file must be rolled over before writing @n bytes.
+// An empty file is never rolled over; its age is restarted instead.
+func (p *RotatingFile) due(n int) bool {
+	aged := p.MaxAge > 0 && Now().Sub(p.opened) >= p.MaxAge
+	if p.size == 0 {
+		if aged {
+			p.opened = Now()
+		}
+		return false
+	}
+
+	return aged || (p.MaxBytes > 0 && p.size+int64(n) > p.MaxBytes)
+}
+
+// Write writes @b to the file, rolling it over first if due. If that
+// fails, @b is still written to the current file and the error returned.
+func (p *RotatingFile) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	var rerr error
+	if p.due(len(b)) {
+		rerr = p.rotate()
+	}
+
+	n, err := p.f.Write(b)
+	p.size += int64(n)
+	if err == nil {
+		err = rerr
+	}
+	return n, err
+}
+
+// Rotate rolls the file over right away
+func (p *RotatingFile) Rotate() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.f == nil {
+		return os.ErrClosed
+	}
+
+	return p.rotate()
+}
+
+func (p *RotatingFile) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", p.Path, i)
+}
+
+// rotate moves the file aside and opens a new one, leaving the backups
+// to shiftBackups. The file is moved while still open, so on any error
+// the current file is kept and logging goes on to it.
+func (p *RotatingFile) rotate() error {
+	tmp, err := os.CreateTemp(filepath.Dir(p.Path), filepath.Base(p.Path)+".rotating-*")
+	if err != nil {
+		return err
+	}
+	aside := tmp.Name()
+	tmp.Close()
+
+	if err := os.Rename(p.Path, aside); err != nil {
+		os.Remove(aside)
+		return err
+	}
+
+	f := p.f
+	if err := p.open(); err != nil {
+		os.Rename(aside, p.Path)
+		return err
+	}
+	f.Close()
+
+	p.rotated = append(p.rotated, aside)
+	if !p.shifting {
+		p.shifting = true
+		p.shifts.Add(1)
+		go p.shiftBackups()
+	}
+
+	return nil
+}
+
+// shiftBackups turns the files moved aside by rotate into backups, in
+// the order they were rotated: the backups are shifted up by one, the
+// oldest dropped, the file renamed to path.1 and gzipped if Compress is
+// set. It runs until there is nothing left to shift. A file that can't be
+// renamed is left as it is, under its path.rotating-* name.
+func (p *RotatingFile) shiftBackups() {
+	defer p.shifts.Done()
+
+	for {
+		p.mu.Lock()
+		if len(p.rotated) == 0 {
+			p.shifting = false
+			p.mu.Unlock()
+			return
+		}
+		aside := p.rotated[0]
+		p.rotated = p.rotated[1:]
+		p.mu.Unlock()
+
+		last := p.backupName(p.MaxBackups)
+		os.Remove(last)
+		os.Remove(last + ".gz")
+
+		for i := p.MaxBackups - 1; i >= 1; i-- {
+			for _, ext := range []string{"", ".gz"} {
+				os.Rename(p.backupName(i)+ext, p.backupName(i+1)+ext)
+			}
+		}
+
+		backup := p.backupName(1)
+		if err := os.Rename(aside, backup); err != nil {
+			continue
+		}
+
+		if p.Compress {
+			compressFile(backup)
+		}
+	}
+}
+
+// Close stops the age check, closes the file and waits for the
+// backups to be shifted and compressed
+func (p *RotatingFile) Close() error {
+	p.mu.Lock()
+
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+
+	var err error
+	if p.f != nil {
+		err = p.f.Close()
+		p.f = nil
+	}
+
+	p.mu.Unlock()
+
+	// shiftBackups takes p.mu, so this can't wait holding it
+	p.shifts.Wait()
+	return err
+}
+
+// compressFile gzips @path to @path.gz and removes @path. The data is
+// written to a temporary file first and renamed into place, so a crash
+// leaves either the original or a complete .gz, never a truncated one.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// TimedRotatingFile is a file writer that starts a new file at every
+// Interval boundary of the wall clock (in local time):
+//	hourly	at the top of every hour, path.2006-01-02T15
+//	daily	at midnight, path.2006-01-02
+//	weekly	at midnight between Sunday and Monday, path.2006-01-02
+//		(the date being the Monday the week starts on)
+// Records are written straight to the file of the period they are
+// written in, named after the period's start as shown above. With
+// Compress set, the file of a period that ended is gzipped (eg:
+// path.2006-01-02.gz) in the background.
+type TimedRotatingFile struct {
+	Path     string
+	Interval string // hourly | daily | weekly
+	Compress bool
+
+	mu          sync.Mutex
+	f           *os.File
+	next        time.Time // start of the next period
+	compressing sync.WaitGroup
+}
+
+// periodStart returns the start of the @interval period that @t is in
+func periodStart(interval string, t time.Time) (time.Time, error) {
+	y, m, d := t.Date()
+	switch interval {
+	case "hourly":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location()), nil
+	case "daily":
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), nil
+	case "weekly":
+		// days since Monday
+		back := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-back, 0, 0, 0, 0, t.Location()), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: unknown interval %q", BadConf, interval)
+}
+
+// periodEnd returns the start of the @interval period following the
+// one starting at @start. Dates are normalized by time.Date so that this
+// stays on the wall clock across DST changes.
+func periodEnd(interval string, start time.Time) time.Time {
+	y, m, d := start.Date()
+	switch interval {
+	case "hourly":
+		return time.Date(y, m, d, start.Hour()+1, 0, 0, 0, start.Location())
+	case "weekly":
+		return time.Date(y, m, d+7, 0, 0, 0, 0, start.Location())
+	default: // daily
+		return time.Date(y, m, d+1, 0, 0, 0, 0, start.Location())
+	}
+}
+
+func (p *TimedRotatingFile) fileName(start time.Time) string {
+	if p.Interval == "hourly" {
+		return p.Path + start.Format(".2006-01-02T15")
+	}
+	return p.Path + start.Format(".2006-01-02")
+}
+
+// Open opens (or creates) the file of the current period for appending
+func (p *TimedRotatingFile) Open() error {
+	if _, err := periodStart(p.Interval, Now()); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.open(Now())
+}
+
+func (p *TimedRotatingFile) open(now time.Time) error {
+	start, err := periodStart(p.Interval, now)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p.fileName(start), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	p.f, p.next = f, periodEnd(p.Interval, start)
+	return nil
+}
+
+// Write writes @b to the file of the current period, switching files
+// first if a boundary was crossed. Writes and switches are serialized so
+// a record is never split across files or lost during a switch.
+func (p *TimedRotatingFile) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	var rerr error
+	if now := Now(); !now.Before(p.next) {
+		rerr = p.rotate(now)
+	}
+
+	n, err := p.f.Write(b)
+	if err == nil {
+		err = rerr
+	}
+	return n, err
+}
+
+// rotate opens the file of the period @now is in, then closes the
+// previous one. If the new file can't be opened, the previous one is
+// kept and the switch retried on the next write.
+func (p *TimedRotatingFile) rotate(now time.Time) error {
+	f := p.f
+	if err := p.open(now); err != nil {
+		return err
+	}
+
+	closed := f.Name()
+	f.Close()
+
+	if p.Compress {
+		p.compressing.Add(1)
+		go func() {
+			defer p.compressing.Done()
+			compressFile(closed)
+		}()
+	}
+
+	return nil
+}
+
+// Close waits for pending compression and closes the current file
+func (p *TimedRotatingFile) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.compressing.Wait()
+
+	if p.f == nil {
+		return nil
+	}
+
+	err := p.f.Close()
+	p.f = nil
+	return err
+}
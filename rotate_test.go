@@ -0,0 +1,107 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readGzip returns the uncompressed content of the gzip file at @path
+func readGzip(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// TestRotatingFileBackups checks that rolling over shifts the backups,
+// drops the oldest and compresses them, leaving no file aside
+func TestRotatingFileBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+
+	rf := &RotatingFile{Path: path, MaxBytes: 3, MaxBackups: 2, Compress: true}
+	if err := rf.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"aa\n", "bb\n", "cc\n", "dd\n"} {
+		if _, err := rf.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "dd\n" {
+		t.Errorf("expected the file to hold dd, got %q", b)
+	}
+
+	for i, want := range map[int]string{1: "cc\n", 2: "bb\n"} {
+		if got := readGzip(t, rf.backupName(i)+".gz"); got != want {
+			t.Errorf("backup %d: expected %q, got %q", i, want, got)
+		}
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Errorf("expected the file and 2 backups, got %v", names)
+	}
+}
+
+// TestRotatingFileRotateFailure checks that a failed roll over leaves
+// the current file open for writing
+func TestRotatingFileRotateFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rf := &RotatingFile{Path: filepath.Join(dir, "log"), MaxBytes: 3, MaxBackups: 1}
+	if err := rf.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	if _, err := rf.Write([]byte("aa\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing can be moved aside in a removed directory
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		n, err := rf.Write([]byte("bb\n"))
+		if err == nil {
+			t.Fatal("expected the roll over to fail")
+		}
+		if errors.Is(err, os.ErrClosed) || n != 3 {
+			t.Fatalf("write %d: expected the record written to the current file, got %d, %v", i, n, err)
+		}
+	}
+}
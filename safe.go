@@ -0,0 +1,38 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"time"
+)
+
+// SafeHandler returns a handler that recovers from a panic in @h's Log
+// and returns it as an error instead of crashing the application from
+// the logging path. If @fallback is not nil, a crit record describing
+// the panic (along with the original message) is written to it.
+func SafeHandler(h Handler, fallback Handler) Handler {
+	return log15.FuncHandler(func(r *log15.Record) (err error) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+
+			err = fmt.Errorf("log: handler panicked: %v", v)
+			if fallback == nil {
+				return
+			}
+
+			fallback.Log(&log15.Record{
+				Time:     time.Now(),
+				Lvl:      log15.LvlCrit,
+				Msg:      "log handler panicked",
+				Ctx:      []interface{}{"panic", fmt.Sprint(v), "orig_msg", r.Msg},
+				Call:     r.Call,
+				KeyNames: r.KeyNames,
+			})
+		}()
+
+		return h.Log(r)
+	})
+}
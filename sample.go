@@ -0,0 +1,118 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// NewRandSource creates the random source used by the sampling handlers,
+// seeded with the time by default.
+// Tests may override it with a fixed seed for deterministic sampling, eg:
+//	log.NewRandSource = func() rand.Source { return rand.NewSource(1) }
+var NewRandSource = func() rand.Source {
+	return rand.NewSource(time.Now().UnixNano())
+}
+
+// Now is the clock used by the delayed sampling, rate limiting, dedup,
+// repeat escalation, span timing, request buffering and file rotation
+// handlers, TimeOp and LogSummary, to tell the time.
+// Tests may override it to move through time without sleeping.
+var Now = time.Now
+
+// lockedRand is a rand.Rand safe for use from many goroutines
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand() *lockedRand {
+	return &lockedRand{r: rand.New(NewRandSource())}
+}
+
+func (p *lockedRand) Float64() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.r.Float64()
+}
+
+// LevelSampleHandler returns a handler that forwards each record to @h
+// with the probability given for its level in @rates. Levels missing
+// from @rates are always forwarded.
+func LevelSampleHandler(rates map[Lvl]float64, h Handler) Handler {
+	rnd := newLockedRand()
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		rate, ok := rates[Lvl(r.Lvl)]
+		if !ok || rate >= 1 {
+			return h.Log(r)
+		}
+
+		if rate <= 0 || rnd.Float64() >= rate {
+			return nil
+		}
+
+		return h.Log(r)
+	})
+}
+
+// MakeLevelRates validates a level name -> keep probability mapping
+// as used by the "level_sample" handler
+func MakeLevelRates(rates map[string]float64) (map[Lvl]float64, error) {
+	res := make(map[Lvl]float64, len(rates))
+	for name, rate := range rates {
+		lvl, err := log15.LvlFromString(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown level %q", BadConf, name)
+		}
+
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("%w: rate of %s: expected a rate between 0 and 1, got %v", BadConf, name, rate)
+		}
+
+		res[Lvl(lvl)] = rate
+	}
+
+	return res, nil
+}
+
+// DelayedSampleHandler returns a handler that forwards every record to
+// @h during the first @warmup after process start, so that startup
+// diagnostics are complete, and from then on forwards each record with
+// probability @rate.
+func DelayedSampleHandler(warmup time.Duration, rate float64, h Handler) Handler {
+	rnd := newLockedRand()
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		if rate >= 1 || Now().Sub(processStart) < warmup {
+			return h.Log(r)
+		}
+
+		if rate <= 0 || rnd.Float64() >= rate {
+			return nil
+		}
+
+		return h.Log(r)
+	})
+}
+
+// SampleHandler returns a handler that forwards each record to @h with
+// probability @rate, except error and crit records which are always
+// forwarded. Override NewRandSource for a deterministic sample.
+func SampleHandler(rate float64, h Handler) Handler {
+	rnd := newLockedRand()
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		if rate >= 1 || r.Lvl <= log15.LvlError {
+			return h.Log(r)
+		}
+
+		if rate <= 0 || rnd.Float64() >= rate {
+			return nil
+		}
+
+		return h.Log(r)
+	})
+}
@@ -0,0 +1,322 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SentryBufferSize is the number of events a SentryHandler holds while
+// they are being sent. Events captured when it is full are dropped.
+var SentryBufferSize = 100
+
+// SentryLevels maps log15 levels to Sentry event levels
+var SentryLevels = map[Lvl]string{
+	LvlCrit:  "fatal",
+	LvlError: "error",
+	LvlWarn:  "warning",
+	LvlInfo:  "info",
+	LvlDebug: "debug",
+}
+
+// the limits Sentry puts on tags; longer ones are only sent as extra
+const (
+	sentryMaxTagKey   = 32
+	sentryMaxTagValue = 200
+)
+
+// SentryHandler forwards every record to the wrapped handler and also
+// captures those at or above a level as Sentry events, with the message,
+// the level, string, number and bool ctx fields as tags and all ctx
+// fields as extra data. The "stack" added by the caller_stack and
+// caller_stack_structured handlers, or the ErrorStackKey added by the
+// error_stack handler, becomes the event's stack trace.
+//
+// Events are sent from a goroutine, through a buffer of SentryBufferSize
+// events, so that logging never waits on Sentry. Events that can't be
+// sent are counted (see Dropped).
+type SentryHandler struct {
+	MinLvl Lvl
+
+	h       Handler
+	dsn     string
+	url     string // of the envelope endpoint
+	auth    string // the X-Sentry-Auth header
+	client  *http.Client
+	events  chan []byte
+	mu      sync.RWMutex
+	closed  bool
+	dropped uint64
+	wg      sync.WaitGroup
+}
+
+// MakeSentryHandler prepares a handler capturing records at or above
+// @minLvl (ie: as or more severe) as events of the Sentry project at
+// @dsn, and forwarding all records to @h. A malformed @dsn is BadConf.
+func MakeSentryHandler(dsn string, minLvl Lvl, h Handler) (*SentryHandler, error) {
+	endpoint, auth, err := parseSentryDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &SentryHandler{
+		MinLvl: minLvl,
+		h:      h,
+		dsn:    dsn,
+		url:    endpoint,
+		auth:   auth,
+		client: &http.Client{Timeout: 10 * time.Second},
+		events: make(chan []byte, SentryBufferSize),
+	}
+
+	p.wg.Add(1)
+	go p.send()
+
+	return p, nil
+}
+
+// parseSentryDSN returns the envelope endpoint and the auth header of
+// a DSN such as https://<key>@o1.ingest.sentry.io/<project id>
+func parseSentryDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: bad sentry dsn: %v", BadConf, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", fmt.Errorf("%w: bad sentry dsn: expected an http or https scheme, got %q", BadConf, u.Scheme)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("%w: bad sentry dsn: no host", BadConf)
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("%w: bad sentry dsn: no public key", BadConf)
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndexByte(path, '/')
+	project := path[i+1:]
+	if _, err := strconv.ParseUint(project, 10, 64); err != nil {
+		return "", "", fmt.Errorf("%w: bad sentry dsn: expected a numeric project id, got %q", BadConf, project)
+	}
+
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, path[:i], project)
+
+	auth := "Sentry sentry_version=7, sentry_client=deep-compute-log/1.0, sentry_key=" + u.User.Username()
+	if secret, ok := u.User.Password(); ok && secret != "" {
+		auth += ", sentry_secret=" + secret
+	}
+
+	return endpoint, auth, nil
+}
+
+func (p *SentryHandler) Log(r *log15.Record) error {
+	if Lvl(r.Lvl) <= p.MinLvl {
+		p.capture(r)
+	}
+	return p.h.Log(r)
+}
+
+// capture queues the Sentry event of @r
+func (p *SentryHandler) capture(r *log15.Record) {
+	b := p.envelope(r)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		atomic.AddUint64(&p.dropped, 1)
+		return
+	}
+
+	select {
+	case p.events <- b:
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+	}
+}
+
+type sentryFrame struct {
+	Filename string `json:"filename"`
+	Function string `json:"function,omitempty"`
+	Lineno   int    `json:"lineno,omitempty"`
+	InApp    bool   `json:"in_app"`
+}
+
+// envelope returns the Sentry envelope holding the event of @r
+func (p *SentryHandler) envelope(r *log15.Record) []byte {
+	id := strings.Replace(IDGenerator(), "-", "", -1)
+
+	event := map[string]interface{}{
+		"event_id":  id,
+		"timestamp": r.Time.UTC().Format(time.RFC3339Nano),
+		"level":     SentryLevels[Lvl(r.Lvl)],
+		"platform":  "go",
+		"logger":    "log",
+		"message":   map[string]string{"formatted": r.Msg},
+	}
+
+	tags := make(map[string]string)
+	extra := make(map[string]interface{})
+	var frames []sentryFrame
+
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		k := fmt.Sprint(r.Ctx[i])
+		v := r.Ctx[i+1]
+
+		if (k == "stack" || k == ErrorStackKey) && frames == nil {
+			if frames = sentryFrames(v); frames != nil {
+				continue
+			}
+		}
+
+		switch c := v.(type) {
+		case error:
+			v = c.Error()
+		case fmt.Stringer:
+			v = c.String()
+		}
+
+		switch v.(type) {
+		case string, bool, int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64, float32, float64:
+			if s := fmt.Sprint(v); len(k) <= sentryMaxTagKey && len(s) <= sentryMaxTagValue {
+				tags[k] = s
+			}
+		}
+		extra[k] = v
+	}
+
+	if len(tags) > 0 {
+		event["tags"] = tags
+	}
+	if len(extra) > 0 {
+		event["extra"] = extra
+	}
+	if frames != nil {
+		event["threads"] = map[string]interface{}{
+			"values": []interface{}{map[string]interface{}{
+				"current":    true,
+				"stacktrace": map[string]interface{}{"frames": frames},
+			}},
+		}
+	}
+
+	eb, err := json.Marshal(event)
+	if err != nil {
+		// some extra value can't be encoded, send it as text
+		for k, v := range extra {
+			if _, err := json.Marshal(v); err != nil {
+				extra[k] = fmt.Sprintf("%+v", v)
+			}
+		}
+		eb, _ = json.Marshal(event)
+	}
+
+	header, _ := json.Marshal(map[string]string{
+		"event_id": id,
+		"dsn":      p.dsn,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+	})
+
+	var b bytes.Buffer
+	b.Write(header)
+	b.WriteString("\n{\"type\":\"event\",\"length\":")
+	b.WriteString(strconv.Itoa(len(eb)))
+	b.WriteString("}\n")
+	b.Write(eb)
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// sentryFrames returns the Sentry frames of the stack @v as added by the
+// caller_stack ("[a.go:12 b.go:34]") or caller_stack_structured handlers,
+// or nil if @v isn't one. Sentry lists the outermost call first.
+func sentryFrames(v interface{}) []sentryFrame {
+	var frames []sentryFrame
+
+	switch s := v.(type) {
+	case []StackFrame:
+		for _, f := range s {
+			frames = append(frames, sentryFrame{Filename: f.File, Function: f.Func, Lineno: f.Line, InApp: true})
+		}
+
+	case string:
+		for _, call := range strings.Fields(strings.Trim(s, "[]")) {
+			f := sentryFrame{Filename: call, InApp: true}
+			if i := strings.LastIndexByte(call, ':'); i > 0 {
+				if line, err := strconv.Atoi(call[i+1:]); err == nil {
+					f.Filename, f.Lineno = call[:i], line
+				}
+			}
+			frames = append(frames, f)
+		}
+
+	default:
+		return nil
+	}
+
+	if len(frames) == 0 {
+		return nil
+	}
+
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+// send posts the queued events until the handler is closed
+func (p *SentryHandler) send() {
+	defer p.wg.Done()
+
+	for b := range p.events {
+		req, err := http.NewRequest("POST", p.url, bytes.NewReader(b))
+		if err != nil {
+			atomic.AddUint64(&p.dropped, 1)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/x-sentry-envelope")
+		req.Header.Set("X-Sentry-Auth", p.auth)
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			atomic.AddUint64(&p.dropped, 1)
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			atomic.AddUint64(&p.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of events that could not be sent
+func (p *SentryHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
+// Close sends the queued events, stops the handler and then flushes and
+// closes the wrapped handler if it needs it. It is safe to call Close
+// more than once.
+func (p *SentryHandler) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.events)
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	return closeTree(p.h)
+}
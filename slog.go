@@ -0,0 +1,136 @@
+package log
+
+import (
+	"context"
+	"github.com/go-stack/stack"
+	"gopkg.in/inconshreveable/log15.v2"
+	"log/slog"
+	"time"
+)
+
+// slogHandler passes slog records on to a Handler
+type slogHandler struct {
+	h      Handler
+	ctx    []interface{} // from WithAttrs
+	prefix string        // from WithGroup, eg: "req.headers."
+}
+
+// NewSlogHandler returns an slog.Handler logging to @h, so that code
+// written against log/slog can use handlers built with MakeHandler, eg:
+//	h, _ := log.MakeHandler(conf)
+//	logger := slog.New(log.NewSlogHandler(h))
+// slog levels map to the nearest log15 level at or below them (ie:
+// LevelError+4 and above is crit) and attributes become ctx pairs. The
+// keys of grouped attributes are prefixed with the group names joined by
+// dots, eg: slog.Group("req", "id", 3) is logged as req.id=3.
+func NewSlogHandler(h Handler) slog.Handler {
+	return &slogHandler{h: h}
+}
+
+// Enabled always says yes; level filtering is up to the handlers
+func (p *slogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (p *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	ctx := make([]interface{}, len(p.ctx), len(p.ctx)+2*r.NumAttrs())
+	copy(ctx, p.ctx)
+	r.Attrs(func(a slog.Attr) bool {
+		ctx = appendSlogAttr(ctx, p.prefix, a)
+		return true
+	})
+
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	return p.h.Log(&log15.Record{
+		Time:     t,
+		Lvl:      log15.Lvl(slogLvl(r.Level)),
+		Msg:      r.Message,
+		Ctx:      ctx,
+		Call:     slogCall(r.PC),
+		KeyNames: log15.RecordKeyNames(DefaultKeyNames),
+	})
+}
+
+func (p *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return p
+	}
+
+	ctx := make([]interface{}, len(p.ctx), len(p.ctx)+2*len(attrs))
+	copy(ctx, p.ctx)
+	for _, a := range attrs {
+		ctx = appendSlogAttr(ctx, p.prefix, a)
+	}
+
+	return &slogHandler{h: p.h, ctx: ctx, prefix: p.prefix}
+}
+
+func (p *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return p
+	}
+	return &slogHandler{h: p.h, ctx: p.ctx, prefix: p.prefix + name + "."}
+}
+
+// appendSlogAttr appends @a to @ctx as key, value pairs with
+// the keys prefixed by @prefix, flattening groups
+func appendSlogAttr(ctx []interface{}, prefix string, a slog.Attr) []interface{} {
+	v := a.Value.Resolve()
+
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return ctx
+		}
+
+		// attrs of a group without a name belong to its parent
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range attrs {
+			ctx = appendSlogAttr(ctx, prefix, ga)
+		}
+		return ctx
+	}
+
+	if a.Key == "" {
+		return ctx
+	}
+	return append(ctx, prefix+a.Key, v.Any())
+}
+
+// slogLvl returns the log15 level of the slog level @l
+func slogLvl(l slog.Level) Lvl {
+	switch {
+	case l >= slog.LevelError+4:
+		return LvlCrit
+	case l >= slog.LevelError:
+		return LvlError
+	case l >= slog.LevelWarn:
+		return LvlWarn
+	case l >= slog.LevelInfo:
+		return LvlInfo
+	}
+	return LvlDebug
+}
+
+// slogCall finds the call at @pc on the current stack, so that caller
+// handlers see where the slog call was made. It returns the zero Call if
+// @pc is 0 or not on the stack (eg: the record was handled later).
+func slogCall(pc uintptr) stack.Call {
+	if pc == 0 {
+		return stack.Call{}
+	}
+
+	// slog records the return address; frames report the call itself
+	for _, c := range stack.Trace() {
+		if f := c.Frame(); f.PC == pc-1 || f.PC == pc {
+			return c
+		}
+	}
+	return stack.Call{}
+}
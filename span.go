@@ -0,0 +1,89 @@
+package log
+
+import (
+	"fmt"
+	"github.com/go-stack/stack"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// SpanTimerHandler returns a handler that measures the time between
+// paired records logged with event=start and event=end sharing the same
+// op_id. The end record is passed on with a duration_ms ctx field added.
+// End records without a matching start pass through unchanged. Starts
+// that see no end within @timeout are forgotten to bound memory.
+func SpanTimerHandler(timeout time.Duration, h Handler) Handler {
+	var (
+		mu        sync.Mutex
+		starts    = make(map[string]time.Time)
+		lastSweep = Now()
+	)
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		var event, opID interface{}
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			switch r.Ctx[i] {
+			case "event":
+				event = r.Ctx[i+1]
+			case "op_id":
+				opID = r.Ctx[i+1]
+			}
+		}
+
+		if opID == nil || (event != "start" && event != "end") {
+			return h.Log(r)
+		}
+
+		mu.Lock()
+		now := Now()
+		if now.Sub(lastSweep) >= timeout {
+			for id, t := range starts {
+				if now.Sub(t) >= timeout {
+					delete(starts, id)
+				}
+			}
+			lastSweep = now
+		}
+
+		id := fmt.Sprint(opID)
+		start, found := starts[id]
+		if event == "start" {
+			starts[id] = r.Time
+		} else {
+			delete(starts, id)
+		}
+		mu.Unlock()
+
+		if event == "end" && found {
+			ms := float64(r.Time.Sub(start)) / float64(time.Millisecond)
+			rc := *r
+			rc.Ctx = append(r.Ctx[:len(r.Ctx):len(r.Ctx)], "duration_ms", ms)
+			return h.Log(&rc)
+		}
+
+		return h.Log(r)
+	})
+}
+
+// TimeOp starts timing the operation @name and returns a function that
+// stops it. Stopping logs the elapsed time through @logger, tagged with
+// op=@name and duration_ms, at debug level or at warn level when it
+// exceeded @threshold, eg:
+//	defer log.TimeOp(lg, "db.query", 100*time.Millisecond)()
+// The record is attributed to the call of TimeOp.
+func TimeOp(logger Logger, name string, threshold time.Duration) func() {
+	call := stack.Caller(1)
+	start := Now()
+
+	return func() {
+		elapsed := Now().Sub(start)
+		ms := float64(elapsed) / float64(time.Millisecond)
+
+		if elapsed > threshold {
+			LogCall(logger, call, LvlWarn, "slow operation", "op", name, "duration_ms", ms)
+		} else {
+			LogCall(logger, call, LvlDebug, "operation done", "op", name, "duration_ms", ms)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestSpanTimerTimeout checks that a start without an end is forgotten
+// once the timeout has passed on the Now clock
+func TestSpanTimerTimeout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func(old func() time.Time) { Now = old }(Now)
+	Now = func() time.Time { return now }
+
+	var got []*log15.Record
+	h := SpanTimerHandler(time.Minute, log15.FuncHandler(func(r *log15.Record) error {
+		got = append(got, r)
+		return nil
+	}))
+
+	span := func(event, id string) {
+		h.Log(&log15.Record{Time: now, Msg: event, Ctx: []interface{}{"event", event, "op_id", id}})
+	}
+
+	span("start", "a")
+	span("start", "b")
+	now = now.Add(30 * time.Second)
+	span("end", "b")
+	now = now.Add(time.Minute)
+	span("start", "c")
+	span("end", "a")
+
+	if n := len(got[2].Ctx); n != 6 || got[2].Ctx[5] != 30000.0 {
+		t.Errorf("b: expected duration_ms=30000, got %v", got[2].Ctx)
+	}
+	if n := len(got[4].Ctx); n != 4 {
+		t.Errorf("a: expected no duration once timed out, got %v", got[4].Ctx)
+	}
+}
+
+// TestSpanTimerCopiesRecord checks that the duration is added to a copy
+// of the end record, leaving the one other handlers see as it is
+func TestSpanTimerCopiesRecord(t *testing.T) {
+	var got *log15.Record
+	h := SpanTimerHandler(time.Minute, log15.FuncHandler(func(r *log15.Record) error {
+		got = r
+		return nil
+	}))
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.Log(&log15.Record{Time: start, Msg: "start", Ctx: []interface{}{"event", "start", "op_id", 1}})
+
+	// room to append in place
+	ctx := append(make([]interface{}, 0, 8), "event", "end", "op_id", 1)
+	r := &log15.Record{Time: start.Add(time.Second), Msg: "end", Ctx: ctx}
+	h.Log(r)
+
+	if got == r || len(r.Ctx) != 4 || ctx[:6][4] != nil {
+		t.Errorf("expected the end record untouched, got %v", ctx[:6])
+	}
+	if len(got.Ctx) != 6 || got.Ctx[5] != 1000.0 {
+		t.Errorf("expected duration_ms=1000, got %v", got.Ctx)
+	}
+}
+
+// TestTimeOp checks that TimeOp measures on the Now clock and
+// attributes its record to its caller
+func TestTimeOp(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func(old func() time.Time) { Now = old }(Now)
+	Now = func() time.Time { return now }
+
+	var got *log15.Record
+	l := New()
+	l.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		got = r
+		return nil
+	}))
+
+	done := TimeOp(l, "db.query", 100*time.Millisecond)
+	_, _, want, _ := runtime.Caller(0)
+	want--
+	now = now.Add(250 * time.Millisecond)
+	done()
+
+	if got == nil || got.Lvl != log15.LvlWarn || got.Ctx[3] != 250.0 {
+		t.Fatalf("expected a slow operation warning of 250ms, got %+v", got)
+	}
+	if f := got.Call.Frame(); filepath.Base(f.File) != "span_test.go" || f.Line != want {
+		t.Errorf("expected the call at span_test.go:%d, got %s:%d", want, f.File, f.Line)
+	}
+}
@@ -0,0 +1,236 @@
+// sqlitelog package writes log records to an SQLite database so that
+// small deployments get SQL-queryable logs without an external system.
+//
+// The package does not pull in an SQLite driver; import one and set
+// DriverName if it doesn't register itself as "sqlite3", eg:
+//
+//	import _ "github.com/mattn/go-sqlite3"
+//
+//	h, err := sqlitelog.Open("/var/log/app.db")
+//	...
+//	log.SetHandler(h)
+//	defer h.Close()
+//
+// Records go to a "logs" table with the columns
+//
+//	time	INTEGER	unix time in nanoseconds (indexed)
+//	level	INTEGER	log15 level, 0 (crit) to 4 (debug) (indexed)
+//	message	TEXT
+//	ctx	TEXT	the ctx fields as a JSON object
+package sqlitelog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/deep-compute/log"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync"
+	"time"
+)
+
+// DriverName is the database/sql driver used by Open
+var DriverName = "sqlite3"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS logs (
+	time INTEGER NOT NULL,
+	level INTEGER NOT NULL,
+	message TEXT NOT NULL,
+	ctx TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS logs_time ON logs (time);
+CREATE INDEX IF NOT EXISTS logs_level ON logs (level);
+`
+
+type row struct {
+	time  int64
+	level int
+	msg   string
+	ctx   string
+}
+
+// Handler batches records and inserts them in a single transaction once
+// BatchSize records are pending or every FlushInterval, whichever comes
+// first.
+type Handler struct {
+	BatchSize     int
+	FlushInterval time.Duration
+
+	db      *sql.DB
+	mu      sync.Mutex
+	pending []row
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// Open opens (creating if needed) the database at @path
+// and starts the periodic flush
+func Open(path string) (*Handler, error) {
+	db, err := sql.Open(DriverName, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	p := &Handler{
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		db:            db,
+		done:          make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.flushPeriodically()
+
+	return p, nil
+}
+
+func (p *Handler) flushPeriodically() {
+	defer p.wg.Done()
+
+	t := time.NewTicker(p.FlushInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+			p.Flush()
+		}
+	}
+}
+
+func (p *Handler) Log(r *log15.Record) error {
+	ctx := make(map[string]interface{}, len(r.Ctx)/2)
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		ctx[fmt.Sprint(r.Ctx[i])] = jsonValue(r.Ctx[i+1])
+	}
+
+	b, err := json.Marshal(ctx)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.pending = append(p.pending, row{r.Time.UnixNano(), int(r.Lvl), r.Msg, string(b)})
+	full := len(p.pending) >= p.BatchSize
+	p.mu.Unlock()
+
+	if full {
+		return p.Flush()
+	}
+
+	return nil
+}
+
+// jsonValue makes @v safe to marshal, falling back to its string form
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return v
+}
+
+// Flush inserts all pending records in one transaction
+func (p *Handler) Flush() error {
+	p.mu.Lock()
+	rows := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO logs (time, level, message, ctx) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range rows {
+		if _, err := stmt.Exec(r.time, r.level, r.msg, r.ctx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Entry is a record read back from the database
+type Entry struct {
+	Time time.Time
+	Lvl  log.Lvl
+	Msg  string
+	Ctx  map[string]interface{}
+}
+
+// RecentErrors returns up to @limit of the latest records at error
+// level or above, newest first. Pending records are flushed first.
+func (p *Handler) RecentErrors(limit int) ([]Entry, error) {
+	if err := p.Flush(); err != nil {
+		return nil, err
+	}
+
+	rows, err := p.db.Query(
+		"SELECT time, level, message, ctx FROM logs WHERE level <= ? ORDER BY time DESC LIMIT ?",
+		int(log.LvlError), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []Entry
+	for rows.Next() {
+		var (
+			t, lvl int64
+			msg    string
+			ctx    string
+			e      Entry
+		)
+		if err := rows.Scan(&t, &lvl, &msg, &ctx); err != nil {
+			return nil, err
+		}
+
+		e.Time, e.Lvl, e.Msg = time.Unix(0, t), log.Lvl(lvl), msg
+		if err := json.Unmarshal([]byte(ctx), &e.Ctx); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+
+	return res, rows.Err()
+}
+
+// Close stops the periodic flush, flushes pending
+// records and closes the database
+func (p *Handler) Close() error {
+	close(p.done)
+	p.wg.Wait()
+
+	err := p.Flush()
+	if e := p.db.Close(); err == nil {
+		err = e
+	}
+	return err
+}
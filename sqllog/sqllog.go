@@ -0,0 +1,264 @@
+// sqllog package logs the queries executed through a database/sql
+// driver. It lives apart from the log package so that the core stays
+// free of database/sql concerns.
+//
+//	db := sql.OpenDB(sqllog.Wrap(connector, log.Root(), log.LvlDebug))
+//
+// Every statement produces one record with the fields
+//	query		the query text
+//	duration_ms	time taken by the driver
+//	rows		rows affected (Exec only)
+//	error		the error returned by the driver, if any
+// and the call of the code that ran it, for the caller handlers.
+package sqllog
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/deep-compute/log"
+	"github.com/go-stack/stack"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Wrap returns a connector that behaves like @c but logs every
+// statement executed through it to @logger at level @lvl. The optional
+// interfaces database/sql looks for on connections and statements (eg:
+// driver.NamedValueChecker) are forwarded to the driver's.
+func Wrap(c driver.Connector, logger log.Logger, lvl log.Lvl) driver.Connector {
+	return &connector{Connector: c, l: &queryLogger{logger, lvl}}
+}
+
+// pkgPath is the import path of this package, whose frames queryCall
+// skips
+var pkgPath = reflect.TypeOf(queryLogger{}).PkgPath()
+
+type queryLogger struct {
+	logger log.Logger
+	lvl    log.Lvl
+}
+
+func (p *queryLogger) log(query string, start time.Time, res driver.Result, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+
+	ctx := []interface{}{
+		"query", query,
+		"duration_ms", float64(time.Since(start)) / float64(time.Millisecond),
+	}
+
+	if res != nil {
+		if n, e := res.RowsAffected(); e == nil {
+			ctx = append(ctx, "rows", n)
+		}
+	}
+
+	if err != nil {
+		ctx = append(ctx, "error", err)
+	}
+
+	log.LogCall(p.logger, queryCall(), p.lvl, "sql query", ctx...)
+}
+
+// queryCall returns the call that ran the query: the first one on the
+// stack past this package's wrappers and database/sql
+func queryCall() stack.Call {
+	calls := stack.Trace()
+	i := 0
+	for i < len(calls) && strings.HasPrefix(calls[i].Frame().Function, pkgPath+".") {
+		i++
+	}
+	for i < len(calls) && strings.HasPrefix(calls[i].Frame().Function, "database/sql.") {
+		i++
+	}
+
+	if i == len(calls) {
+		return stack.Caller(1)
+	}
+	return calls[i]
+}
+
+type connector struct {
+	driver.Connector
+	l *queryLogger
+}
+
+func (p *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	c, err := p.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, l: p.l}, nil
+}
+
+type conn struct {
+	driver.Conn
+	l *queryLogger
+}
+
+// CheckNamedValue forwards to the driver's connection if it checks
+// values, otherwise database/sql converts them as usual
+func (p *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := p.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (p *conn) ResetSession(ctx context.Context) error {
+	if sr, ok := p.Conn.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (p *conn) IsValid() bool {
+	if v, ok := p.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (p *conn) Prepare(query string) (driver.Stmt, error) {
+	return p.PrepareContext(context.Background(), query)
+}
+
+func (p *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		s   driver.Stmt
+		err error
+	)
+
+	if pc, ok := p.Conn.(driver.ConnPrepareContext); ok {
+		s, err = pc.PrepareContext(ctx, query)
+	} else {
+		s, err = p.Conn.Prepare(query)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: s, conn: p, query: query, l: p.l}, nil
+}
+
+func (p *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bc, ok := p.Conn.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	return p.Conn.Begin()
+}
+
+func (p *conn) Ping(ctx context.Context) error {
+	if pc, ok := p.Conn.(driver.Pinger); ok {
+		return pc.Ping(ctx)
+	}
+	return nil
+}
+
+func (p *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := p.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	res, err := ec.ExecContext(ctx, query, args)
+	p.l.log(query, start, res, err)
+	return res, err
+}
+
+func (p *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, ok := p.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	rows, err := qc.QueryContext(ctx, query, args)
+	p.l.log(query, start, nil, err)
+	return rows, err
+}
+
+type stmt struct {
+	driver.Stmt
+	conn  *conn
+	query string
+	l     *queryLogger
+}
+
+// CheckNamedValue forwards to the driver's statement if it checks values,
+// or else to its connection: database/sql asks the statement first and
+// only falls back to the connection if the statement doesn't check values
+func (p *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := p.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return p.conn.CheckNamedValue(nv)
+}
+
+func (p *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	start := time.Now()
+	res, err := p.Stmt.Exec(args)
+	p.l.log(p.query, start, res, err)
+	return res, err
+}
+
+func (p *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := p.Stmt.Query(args)
+	p.l.log(p.query, start, nil, err)
+	return rows, err
+}
+
+func (p *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+
+	var (
+		res driver.Result
+		err error
+	)
+	if sc, ok := p.Stmt.(driver.StmtExecContext); ok {
+		res, err = sc.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedToValues(args); err == nil {
+			res, err = p.Stmt.Exec(values)
+		}
+	}
+
+	p.l.log(p.query, start, res, err)
+	return res, err
+}
+
+func (p *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if sc, ok := p.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = sc.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedToValues(args); err == nil {
+			rows, err = p.Stmt.Query(values)
+		}
+	}
+
+	p.l.log(p.query, start, nil, err)
+	return rows, err
+}
+
+func namedToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		if a.Name != "" {
+			return nil, driver.ErrSkip
+		}
+		values[i] = a.Value
+	}
+	return values, nil
+}
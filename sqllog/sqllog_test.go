@@ -0,0 +1,169 @@
+package sqllog
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"github.com/deep-compute/log"
+	"gopkg.in/inconshreveable/log15.v2"
+	"io"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeConnector connects to a database that accepts any statement,
+// affecting one row and returning no rows. It counts the calls to the
+// optional interfaces of its connections.
+type fakeConnector struct {
+	invalid                  bool // connections report they can't be reused
+	connects, resets, checks int
+}
+
+func (p *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	p.connects++
+	return &fakeConn{p}, nil
+}
+
+func (p *fakeConnector) Driver() driver.Driver { return nil }
+
+type fakeConn struct {
+	c *fakeConnector
+}
+
+func (p *fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{}, nil }
+func (p *fakeConn) Close() error                              { return nil }
+func (p *fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func (p *fakeConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+// CheckNamedValue accepts points, which database/sql would reject
+func (p *fakeConn) CheckNamedValue(nv *driver.NamedValue) error {
+	p.c.checks++
+	if pt, ok := nv.Value.(point); ok {
+		nv.Value = fmt.Sprintf("(%d,%d)", pt.x, pt.y)
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (p *fakeConn) ResetSession(context.Context) error {
+	p.c.resets++
+	return nil
+}
+
+func (p *fakeConn) IsValid() bool {
+	return !p.c.invalid
+}
+
+type point struct {
+	x, y int
+}
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                               { return nil }
+func (fakeStmt) NumInput() int                              { return -1 }
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return fakeRows{}, nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string              { return []string{"n"} }
+func (fakeRows) Close() error                   { return nil }
+func (fakeRows) Next(dest []driver.Value) error { return io.EOF }
+
+// line returns the line it is called from
+func line() int {
+	_, _, l, _ := runtime.Caller(1)
+	return l
+}
+
+// TestQueryCall checks that query records point at the code running the
+// query, through database/sql and prepared statements, and keep the
+// logger's ctx
+func TestQueryCall(t *testing.T) {
+	var records []*log15.Record
+	logger := log.New("db", "main")
+	logger.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	db := sql.OpenDB(Wrap(&fakeConnector{}, logger, log.LvlInfo))
+	defer db.Close()
+
+	var lines []int
+	_, err := db.Exec("insert into t values (1)")
+	lines = append(lines, line()-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("select n from t")
+	lines = append(lines, line()-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	if len(records) != len(lines) {
+		t.Fatalf("expected %d records, got %d", len(lines), len(records))
+	}
+
+	for i, r := range records {
+		f := r.Call.Frame()
+		if filepath.Base(f.File) != "sqllog_test.go" || f.Line != lines[i] {
+			t.Errorf("record %d: expected the call at sqllog_test.go:%d, got %s:%d", i, lines[i], f.File, f.Line)
+		}
+		if len(r.Ctx) < 2 || r.Ctx[0] != "db" || r.Ctx[1] != "main" {
+			t.Errorf("record %d: expected the logger's ctx first, got %v", i, r.Ctx)
+		}
+	}
+}
+
+// TestForwardedInterfaces checks that the optional interfaces of the
+// driver's connections reach database/sql through the wrappers
+func TestForwardedInterfaces(t *testing.T) {
+	c := &fakeConnector{}
+	db := sql.OpenDB(Wrap(c, log.New(), log.LvlDebug))
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("insert into t values (?)", point{1, 2}); err != nil {
+		t.Fatalf("expected the connection to check the point, got %v", err)
+	}
+
+	s, err := db.Prepare("insert into t values (?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Exec(point{3, 4}); err != nil {
+		t.Fatalf("expected the statement to defer to the connection, got %v", err)
+	}
+	s.Close()
+
+	if _, err := db.Exec("insert into t values (?)", 1); err != nil {
+		t.Fatalf("expected other values converted as usual, got %v", err)
+	}
+
+	if c.checks != 3 {
+		t.Errorf("expected 3 values checked, got %d", c.checks)
+	}
+	if c.resets == 0 {
+		t.Error("expected the session reset on reuse")
+	}
+	if c.connects != 1 {
+		t.Errorf("expected the connection reused, got %d connects", c.connects)
+	}
+
+	c.invalid = true
+	db.Exec("insert into t values (1)")
+	db.Exec("insert into t values (1)")
+	if c.connects != 2 {
+		t.Errorf("expected an invalid connection replaced, got %d connects", c.connects)
+	}
+}
@@ -0,0 +1,125 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"net/http"
+	"sync"
+)
+
+// SSEHandler streams formatted records to browsers as Server-Sent
+// Events. It is both a log Handler and an http.Handler: mount it on a
+// route and every connected client receives each new record as a
+// "data:" event. A client that can't keep up has records dropped rather
+// than slowing down the logger. At most MaxClients may be connected at
+// once; further clients are turned away with 503.
+type SSEHandler struct {
+	MaxClients int
+
+	formatter log15.Format
+	mu        sync.Mutex
+	clients   map[chan []byte]struct{}
+}
+
+// sseClientBuffer is the number of records buffered per client
+const sseClientBuffer = 64
+
+// MakeSSEHandler prepares an SSE handler formatting records as per
+// @format and accepting up to @maxClients concurrent subscribers.
+func MakeSSEHandler(format FormatConf, maxClients int) (*SSEHandler, error) {
+	formatter, err := MakeFormatter(format)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxClients < 1 {
+		return nil, fmt.Errorf("%w: expected max clients of at least 1, got %d", BadConf, maxClients)
+	}
+
+	return &SSEHandler{
+		MaxClients: maxClients,
+		formatter:  formatter,
+		clients:    make(map[chan []byte]struct{}),
+	}, nil
+}
+
+func (p *SSEHandler) Log(r *log15.Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.clients) == 0 {
+		return nil
+	}
+
+	b := p.formatter.Format(r)
+	for c := range p.clients {
+		select {
+		case c <- b:
+		default:
+			// slow client, drop
+		}
+	}
+
+	return nil
+}
+
+func (p *SSEHandler) subscribe() (chan []byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.clients) >= p.MaxClients {
+		return nil, false
+	}
+
+	c := make(chan []byte, sseClientBuffer)
+	p.clients[c] = struct{}{}
+	return c, true
+}
+
+func (p *SSEHandler) unsubscribe(c chan []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.clients, c)
+}
+
+func (p *SSEHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	c, ok := p.subscribe()
+	if !ok {
+		http.Error(w, "too many subscribers", http.StatusServiceUnavailable)
+		return
+	}
+	defer p.unsubscribe(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case b := <-c:
+			// every line of a multi line record needs its own "data:"
+			lines := bytes.Split(bytes.TrimRight(b, "\n"), []byte("\n"))
+			for _, line := range lines {
+				if _, err := fmt.Fprintf(w, "data: %s\n", line); err != nil {
+					return
+				}
+			}
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
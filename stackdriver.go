@@ -0,0 +1,93 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+	"strings"
+	"time"
+)
+
+// StackdriverSeverity maps log15 levels to the Google Cloud Logging
+// severities of the "stackdriver" format
+var StackdriverSeverity = map[Lvl]string{
+	LvlCrit:  "CRITICAL",
+	LvlError: "ERROR",
+	LvlWarn:  "WARNING",
+	LvlInfo:  "INFO",
+	LvlDebug: "DEBUG",
+}
+
+// the key Cloud Logging reads the source location of an entry from
+const stackdriverSourceKey = "logging.googleapis.com/sourceLocation"
+
+// StackdriverFormat renders each record as a line of the structured JSON
+// the Google Cloud Logging agent (eg: on GKE) understands: "severity" as
+// per StackdriverSeverity, "message", "timestamp" in RFC3339Nano and the
+// ctx fields at the top level, which Cloud Logging puts in jsonPayload.
+// The "caller" and "fn" fields added by the caller_file and caller_func
+// handlers become the entry's sourceLocation instead.
+func StackdriverFormat() Format {
+	return log15.FormatFunc(func(r *log15.Record) []byte {
+		m := make(map[string]interface{}, len(r.Ctx)/2+3)
+		var loc map[string]string
+
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			k := fmt.Sprint(r.Ctx[i])
+			v := stackdriverValue(r.Ctx[i+1])
+
+			switch k {
+			case "caller":
+				if s, ok := v.(string); ok {
+					if loc == nil {
+						loc = make(map[string]string)
+					}
+					if j := strings.LastIndexByte(s, ':'); j > 0 {
+						loc["file"], loc["line"] = s[:j], s[j+1:]
+					} else {
+						loc["file"] = s
+					}
+					continue
+				}
+			case "fn":
+				if s, ok := v.(string); ok {
+					if loc == nil {
+						loc = make(map[string]string)
+					}
+					loc["function"] = s
+					continue
+				}
+			}
+
+			m[k] = v
+		}
+
+		m["severity"] = StackdriverSeverity[Lvl(r.Lvl)]
+		m["message"] = r.Msg
+		m["timestamp"] = r.Time.Format(time.RFC3339Nano)
+		if loc != nil {
+			m[stackdriverSourceKey] = loc
+		}
+
+		b, err := json.Marshal(m)
+		if err != nil {
+			b, _ = json.Marshal(map[string]string{
+				"severity":  "ERROR",
+				"message":   r.Msg,
+				"LOG_ERROR": err.Error(),
+			})
+		}
+		return append(b, '\n')
+	})
+}
+
+// stackdriverValue returns @v as it should be JSON encoded
+func stackdriverValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
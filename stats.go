@@ -0,0 +1,89 @@
+package log
+
+import (
+	"github.com/go-stack/stack"
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync/atomic"
+)
+
+// LevelCountHandler counts the records passing through it by level
+// before passing them on to its handler. Each one has counts of its own,
+// so that two of them in the same tree don't count records twice.
+type LevelCountHandler struct {
+	h      Handler
+	counts [5]uint64 // indexed by log15.Lvl, LvlCrit through LvlDebug
+}
+
+// MakeLevelCountHandler prepares a handler counting the records it passes
+// on to @h, see Counts
+func MakeLevelCountHandler(h Handler) *LevelCountHandler {
+	return &LevelCountHandler{h: h}
+}
+
+func (p *LevelCountHandler) Log(r *log15.Record) error {
+	if r.Lvl >= 0 && int(r.Lvl) < len(p.counts) {
+		atomic.AddUint64(&p.counts[r.Lvl], 1)
+	}
+	return p.h.Log(r)
+}
+
+// Counts returns the number of records counted so far per full level
+// name, eg: "error"
+func (p *LevelCountHandler) Counts() map[string]uint64 {
+	res := make(map[string]uint64, len(p.counts))
+	for i := range p.counts {
+		res[lvlName(Lvl(i))] = atomic.LoadUint64(&p.counts[i])
+	}
+	return res
+}
+
+// Close flushes and closes the wrapped handler if it needs it
+func (p *LevelCountHandler) Close() error {
+	return closeTree(p.h)
+}
+
+// the handler built last by StatsHandler, whose counts Stats returns
+var statsHandler atomic.Value // holds a *LevelCountHandler
+
+// StatsHandler returns a handler that counts the records passing
+// through it by level before passing them on to @h, and makes it the
+// one Stats and LogSummary report on.
+func StatsHandler(h Handler) *LevelCountHandler {
+	p := MakeLevelCountHandler(h)
+	statsHandler.Store(p)
+	return p
+}
+
+// Stats returns the number of records counted so far per level name by
+// the "stats" handler built last. A process is expected to build one,
+// around its root handler; if it builds more, the others are only
+// reachable through their own Counts. It returns nil if no "stats"
+// handler was ever built.
+func Stats() map[string]uint64 {
+	p, _ := statsHandler.Load().(*LevelCountHandler)
+	if p == nil {
+		return nil
+	}
+	return p.Counts()
+}
+
+// LogSummary logs an info record with the per level counts from
+// Stats and the process uptime. It is meant to be deferred in main so
+// that every run ends with a consistent summary line:
+//	defer log.LogSummary()
+// The record is attributed to the call of LogSummary, and the uptime
+// measured on the Now clock. It does nothing if no "stats" handler was
+// ever built.
+func LogSummary() {
+	stats := Stats()
+	if stats == nil {
+		return
+	}
+
+	ctx := []interface{}{"uptime", Now().Sub(processStart)}
+	for _, name := range lvlNames {
+		ctx = append(ctx, name, stats[name])
+	}
+
+	LogCall(Root(), stack.Caller(1), LvlInfo, "log summary", ctx...)
+}
@@ -0,0 +1,58 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestStatsNested checks that nested stats handlers each count a record
+// once, by full level name, and that Stats reports the last one built
+func TestStatsNested(t *testing.T) {
+	inner := StatsHandler(log15.DiscardHandler())
+	outer := StatsHandler(log15.LvlFilterHandler(log15.LvlWarn, inner))
+
+	l := log15.New()
+	l.SetHandler(outer)
+	l.Error("failed")
+	l.Error("failed again")
+	l.Info("ok")
+
+	if c := outer.Counts(); c["error"] != 2 || c["info"] != 1 || c["eror"] != 0 || len(c) != 5 {
+		t.Errorf("outer: expected 2 errors and 1 info, got %v", c)
+	}
+	if c := inner.Counts(); c["error"] != 2 || c["info"] != 0 {
+		t.Errorf("inner: expected 2 errors only, got %v", c)
+	}
+	if c := Stats(); c["error"] != 2 || c["info"] != 1 {
+		t.Errorf("Stats: expected the outer counts, got %v", c)
+	}
+}
+
+// TestLogSummary checks that LogSummary attributes its record to its
+// caller and measures the uptime on the Now clock
+func TestLogSummary(t *testing.T) {
+	defer func(old func() time.Time) { Now = old }(Now)
+	Now = func() time.Time { return processStart.Add(time.Hour) }
+
+	var got *log15.Record
+	old := Root().GetHandler()
+	defer Root().SetHandler(old)
+	Root().SetHandler(StatsHandler(log15.FuncHandler(func(r *log15.Record) error {
+		got = r
+		return nil
+	})))
+
+	LogSummary()
+	_, _, want, _ := runtime.Caller(0)
+	want--
+
+	if got == nil || got.Msg != "log summary" || got.Ctx[1] != time.Hour {
+		t.Fatalf("expected a summary with an uptime of 1h, got %+v", got)
+	}
+	if f := got.Call.Frame(); filepath.Base(f.File) != "stats_test.go" || f.Line != want {
+		t.Errorf("expected the call at stats_test.go:%d, got %s:%d", want, f.File, f.Line)
+	}
+}
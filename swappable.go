@@ -0,0 +1,48 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"sync/atomic"
+)
+
+// SwappableHandler forwards records to an inner handler that can be
+// replaced at any time with Swap, eg: to point one branch of a handler
+// tree at a new network address without rebuilding the whole tree.
+// Log never takes a lock; swaps are atomic.
+type SwappableHandler struct {
+	inner atomic.Value // holds a handlerBox
+}
+
+// handlerBox gives atomic.Value a single concrete type to store
+type handlerBox struct {
+	h Handler
+}
+
+// MakeSwappableHandler prepares a swappable handler forwarding to @h
+func MakeSwappableHandler(h Handler) *SwappableHandler {
+	p := &SwappableHandler{}
+	p.Swap(h)
+	return p
+}
+
+func (p *SwappableHandler) Log(r *log15.Record) error {
+	return p.inner.Load().(handlerBox).h.Log(r)
+}
+
+// Swap replaces the inner handler with @h and returns the previous
+// one, which the caller may close once it is no longer needed.
+func (p *SwappableHandler) Swap(h Handler) Handler {
+	old, _ := p.inner.Swap(handlerBox{h}).(handlerBox)
+	return old.h
+}
+
+// Get returns the current inner handler
+func (p *SwappableHandler) Get() Handler {
+	return p.inner.Load().(handlerBox).h
+}
+
+// Close flushes and closes the current inner handler if it needs it.
+// Handlers swapped out earlier are left to whoever swapped them out.
+func (p *SwappableHandler) Close() error {
+	return closeTree(p.Get())
+}
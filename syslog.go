@@ -0,0 +1,46 @@
+package log
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+// SyslogFacility is the facility of the "syslog" and "syslog_net" handlers
+// when none is configured: user, like syslog(3)
+var SyslogFacility = syslog.LOG_USER
+
+// SyslogFacilities maps the facility names understood by the "syslog" and
+// "syslog_net" handlers to their syslog.Priority
+var SyslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// SyslogFacilityFromString returns the facility named @name, in any case,
+// eg: "local0" or "daemon". An unknown name is BadConf.
+func SyslogFacilityFromString(name string) (syslog.Priority, error) {
+	f, ok := SyslogFacilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown syslog facility %q", BadConf, name)
+	}
+	return f, nil
+}
@@ -0,0 +1,139 @@
+package log
+
+import (
+	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/inconshreveable/log15.v2"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TTYStreamHandler returns a handler that writes to @stream in terminal
+// format while it is attached to a TTY and in json format otherwise. The
+// terminal format is colored unless NoColorEnv is set.
+//
+// With @recheck 0 the TTY state is checked once, right now. Otherwise it
+// is checked again every @recheck, so that eg: an operator attaching to a
+// running container's stdout gets readable output while what the
+// container runtime captures stays json. The handler is then an
+// io.Closer whose Close stops the rechecks.
+func TTYStreamHandler(stream *os.File, recheck time.Duration) Handler {
+	p := &ttyStreamHandler{stream: stream}
+	p.check()
+
+	term := log15.TerminalFormat()
+	if os.Getenv(NoColorEnv) != "" {
+		term = TerminalLayoutFormat(nil, termTimeFormat)
+	}
+	json := log15.JsonFormat()
+
+	p.Handler = log15.StreamHandler(stream, log15.FormatFunc(func(r *log15.Record) []byte {
+		if atomic.LoadInt32(&p.isTTY) == 1 {
+			return term.Format(r)
+		}
+		return json.Format(r)
+	}))
+
+	if recheck > 0 {
+		p.ticker = time.NewTicker(recheck)
+		p.done = make(chan struct{})
+		go p.recheck()
+	}
+
+	return p
+}
+
+// ttyStreamHandler is the handler returned by TTYStreamHandler
+type ttyStreamHandler struct {
+	Handler
+	stream *os.File
+	isTTY  int32
+	ticker *time.Ticker // nil when not rechecking
+	done   chan struct{}
+	once   sync.Once
+}
+
+// check updates isTTY from the state of the stream
+func (p *ttyStreamHandler) check() {
+	v := int32(0)
+	if terminal.IsTerminal(int(p.stream.Fd())) {
+		v = 1
+	}
+	atomic.StoreInt32(&p.isTTY, v)
+}
+
+func (p *ttyStreamHandler) recheck() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.ticker.C:
+			p.check()
+		}
+	}
+}
+
+// Close stops rechecking the TTY state. The stream is left open, as by
+// "stream". It is safe to call Close more than once.
+func (p *ttyStreamHandler) Close() error {
+	p.once.Do(func() {
+		if p.ticker != nil {
+			p.ticker.Stop()
+			close(p.done)
+		}
+	})
+	return nil
+}
+
+const (
+	// NoColorEnv names the environment variable that, when not empty,
+	// turns off the colors of the "terminal_color" format (see
+	// https://no-color.org). It takes precedence over ForceColorEnv.
+	NoColorEnv = "NO_COLOR"
+
+	// ForceColorEnv names the environment variable that, when not
+	// empty, colors "terminal_color" output even if it isn't written to
+	// a terminal and has MakeBasicHandler pick it when stderr is piped.
+	ForceColorEnv = "FORCE_COLOR"
+)
+
+// useColor tells if colored output should be written to @stream
+func useColor(stream *os.File) bool {
+	if os.Getenv(NoColorEnv) != "" {
+		return false
+	}
+	if os.Getenv(ForceColorEnv) != "" {
+		return true
+	}
+	return terminal.IsTerminal(int(stream.Fd()))
+}
+
+// ttyColorFormat is a terminal format that is colored only on a TTY
+type ttyColorFormat struct {
+	color, plain Format
+}
+
+// TTYColorFormat is TerminalLayoutFormat with the @colors table when
+// written to a TTY by the "stream" handler, and without colors anywhere
+// else (eg: when the stream is redirected to a file or a pipe). The
+// NoColorEnv and ForceColorEnv environment variables override this.
+func TTYColorFormat(colors map[Lvl]string, layout string) Format {
+	return &ttyColorFormat{
+		color: TerminalLayoutFormat(colors, layout),
+		plain: TerminalLayoutFormat(nil, layout),
+	}
+}
+
+func (f *ttyColorFormat) Format(r *log15.Record) []byte {
+	return f.plain.Format(r)
+}
+
+// streamFormat returns @f as it should be used to write to @stream
+func streamFormat(f Format, stream *os.File) Format {
+	tf, ok := f.(*ttyColorFormat)
+	if ok && useColor(stream) {
+		return tf.color
+	}
+	return f
+}
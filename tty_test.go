@@ -0,0 +1,73 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ttyOutput logs a record through a tty_stream handler writing to a file
+// it is told is a TTY and returns what was written
+func ttyOutput(t *testing.T) string {
+	f, err := os.Create(filepath.Join(t.TempDir(), "tty"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	h := TTYStreamHandler(f, 0)
+	atomic.StoreInt32(&h.(*ttyStreamHandler).isTTY, 1)
+
+	l := log15.New()
+	l.SetHandler(h)
+	l.Warn("disk low", "free", 3)
+
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// TestTTYStreamNoColor checks that NO_COLOR turns off the colors of
+// tty_stream's terminal format
+func TestTTYStreamNoColor(t *testing.T) {
+	t.Setenv(NoColorEnv, "")
+	if s := ttyOutput(t); !strings.Contains(s, "\x1b[") {
+		t.Errorf("expected colors, got %q", s)
+	}
+
+	t.Setenv(NoColorEnv, "1")
+	if s := ttyOutput(t); strings.Contains(s, "\x1b[") || !strings.HasPrefix(s, "[WARN]") {
+		t.Errorf("expected plain terminal format, got %q", s)
+	}
+}
+
+// TestTTYStreamClose checks that closing a tty_stream handler, through
+// the tree it is installed in, stops its rechecks
+func TestTTYStreamClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	h, err := MakeHandler(HandlerConf{"level_filter", "info", HandlerConf{"tty_stream", "stderr", 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := runtime.NumGoroutine(); n <= before {
+		t.Fatalf("expected a goroutine rechecking, got %d then %d", before, n)
+	}
+
+	closeHandler(h)
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the rechecks to stop, got %d goroutines then %d", before, runtime.NumGoroutine())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
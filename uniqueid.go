@@ -0,0 +1,46 @@
+package log
+
+import (
+	"crypto/rand"
+	"fmt"
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+// UniqueIDKey is the ctx key under which unique ids are attached
+const UniqueIDKey = "unique_id"
+
+// IDGenerator generates the ids attached by WithUniqueID and the
+// "unique_id" handler. It defaults to random UUIDv4s; tests may
+// override it for predictable ids.
+var IDGenerator = newUUID
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("log: reading random bytes: %v", err))
+	}
+
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// WithUniqueID returns a child of @logger whose records all carry a
+// newly generated id under UniqueIDKey, eg: one per request handled
+func WithUniqueID(logger Logger) Logger {
+	return logger.New(UniqueIDKey, IDGenerator())
+}
+
+// UniqueIDHandler returns a handler that adds an id generated once, when
+// the handler is built, to every record under UniqueIDKey. Configured
+// at the root it tags all records of a run with the same id.
+func UniqueIDHandler(h Handler) Handler {
+	id := IDGenerator()
+
+	return log15.FuncHandler(func(r *log15.Record) error {
+		r.Ctx = append(r.Ctx, UniqueIDKey, id)
+		return h.Log(r)
+	})
+}
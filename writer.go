@@ -0,0 +1,41 @@
+package log
+
+import (
+	"gopkg.in/inconshreveable/log15.v2"
+	"io"
+	"sync"
+)
+
+type writeCloserHandler struct {
+	log15.Handler
+
+	wc   io.WriteCloser
+	once sync.Once
+	err  error
+}
+
+func (p *writeCloserHandler) Close() error {
+	p.once.Do(func() {
+		p.err = p.wc.Close()
+	})
+	return p.err
+}
+
+// WriteCloserHandler prepares a handler that writes records formatted
+// as per @format to @wc. Closing the handler, eg: with Close while it is
+// installed, closes @wc, only ever once.
+//
+// Writes to @wc are serialized by the handler, so @wc need not be safe
+// for concurrent use, but it must not be written to by anyone else.
+func WriteCloserHandler(wc io.WriteCloser, format FormatConf) (Handler, error) {
+	formatter, err := MakeFormatter(format)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &writeCloserHandler{
+		Handler: log15.StreamHandler(wc, formatter),
+		wc:      wc,
+	}
+	return h, nil
+}
@@ -0,0 +1,30 @@
+package log
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+)
+
+// MakeHandlerFromYAML builds the handler conf written as the YAML
+// document @data with MakeHandler, eg:
+//	- level_filter
+//	- info
+//	- - multi
+//	  - [file, /tmp/test.log, json]
+//	  - [stream, stderr, [terminal, {info: "2"}]]
+// YAML values map to the Go values MakeHandler expects the same way JSON
+// ones do for MakeHandlerFromJSON: sequences become HandlerConf, ints int,
+// floats float64 and mappings typed maps. A handler conf of the wrong
+// shape or type returns an error naming the offending node, eg: $[2][1].
+func MakeHandlerFromYAML(data []byte) (Handler, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("log: yaml conf: %v", err)
+	}
+
+	h, err := makeHandlerFromValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("log: yaml conf: %w", err)
+	}
+	return h, nil
+}
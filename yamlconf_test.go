@@ -0,0 +1,85 @@
+package log
+
+import (
+	"errors"
+	"gopkg.in/inconshreveable/log15.v2"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestYAMLRoundTrip checks that a realistic YAML conf decodes to the
+// HandlerConf it stands for, and that the handler built from it works
+func TestYAMLRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	doc := `
+- level_filter
+- warn
+- - multi
+  - [file, ` + path + `, json]
+  - [stream, stderr, [terminal, {info: "32"}]]
+`
+
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := toConf(v, "$", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := HandlerConf{"level_filter", "warn", HandlerConf{"multi",
+		HandlerConf{"file", path, "json"},
+		HandlerConf{"stream", "stderr", HandlerConf{"terminal", map[string]string{"info": "32"}}},
+	}}
+	if !reflect.DeepEqual(conf, want) {
+		t.Fatalf("expected %#v, got %#v", want, conf)
+	}
+
+	h, err := MakeHandlerFromYAML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeHandler(h)
+
+	l := log15.New()
+	l.SetHandler(h)
+	l.Info("filtered out")
+	l.Warn("disk low", "free", 3)
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); strings.Count(s, "\n") != 1 || !strings.Contains(s, `"msg":"disk low"`) || !strings.Contains(s, `"free":3`) {
+		t.Errorf("expected only the warning in the file, got %q", s)
+	}
+}
+
+// TestYAMLTypeMismatch checks that confs of the wrong shape or types fail
+// with BadConf rather than panicking
+func TestYAMLTypeMismatch(t *testing.T) {
+	for _, doc := range []string{
+		`[buffered, ten, [discard]]`,
+		`[buffered, 10, discard]`,
+		`[level_filter, info, {a: b}]`,
+		`[file, [1, 2], json]`,
+		`[sample, 1, [discard]]`,
+		`[level_filter, ~, [discard]]`,
+		`[[discard]]`,
+		`{name: discard}`,
+		`[]`,
+		`discard`,
+	} {
+		if err := build(t, HandlerConf{doc}, func(HandlerConf) error {
+			_, err := MakeHandlerFromYAML([]byte(doc))
+			return err
+		}); !errors.Is(err, BadConf) {
+			t.Errorf("%s: expected BadConf, got %v", doc, err)
+		}
+	}
+}